@@ -4,16 +4,17 @@ import (
 	"errors"
 	"net/http"
 	"fmt"
-	"io/ioutil"
-	"crypto/rsa"
 	"time"
+	"strconv"
 	"strings"
 
 	"github.com/DarthHater/bored-board-service/database"
 	"github.com/DarthHater/bored-board-service/model"
 	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/DarthHater/bored-board-service/policy"
 	"github.com/gin-gonic/gin"
 	"github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -21,49 +22,70 @@ import (
 // IAuth defines an interface for auth related functionality.
 type IAuth interface {
 	ReadAndSetKeys()
+	ReloadKeys() error
+	JWKS() JWKSet
 	UserIsLoggedIn() gin.HandlerFunc
-	UserIsInRole(d database.IDatabase, roles []constants.Role) gin.HandlerFunc
+	UserIsActive(d database.IDatabase) gin.HandlerFunc
+	UserCanWrite() gin.HandlerFunc
+	RequirePermission(d database.IDatabase, permissions ...constants.Permission) gin.HandlerFunc
+	RequireCategoryPermission(d database.IDatabase, permission constants.Permission, categoryOf CategoryFunc) gin.HandlerFunc
 	CreateToken(user model.User) (string, error)
+	ParseToken(tokenString string) (TokenUser, error)
+	RevokeToken(c *gin.Context) error
+	RevokeUserTokens(userID string) error
 }
 
+const (
+	// AccessTokenLifetime is how long a JWT is valid for. Clients use a refresh token to get a new one.
+	AccessTokenLifetime = 15 * time.Minute
+	// RefreshTokenLifetime is how long a refresh token can be used for before the user has to log in again.
+	RefreshTokenLifetime = 30 * 24 * time.Hour
+)
+
 type Auth struct {
+	Revocations RevocationStore
 }
 
-var (
-	signKey   *rsa.PrivateKey
-	verifyKey *rsa.PublicKey
-)
+// TokenUser is who a JWT was issued to, and when it stops being valid.
+type TokenUser struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// ErrTokenRevoked occurs when a JWT is used after it was revoked by logging out
+var ErrTokenRevoked = errors.New("token has been revoked")
 
-// ReadAndSetKeys will read public and private RSA keys and create a key for signing JWTs.
+// ErrInvalidToken occurs when a JWT can't be read, isn't signed by one of our keys or has expired
+var ErrInvalidToken = errors.New("error reading token")
+
+var keyRing = &KeyRing{}
+
+// ReadAndSetKeys will read the RSA keys used for signing and verifying JWTs, exiting if they can't be loaded.
 func (a *Auth) ReadAndSetKeys() {
 	a.setUpViper()
 
-	privKeyPath := viper.GetString("PRIVATE_KEY_PATH")
-	pubKeyPath := viper.GetString("PUBLIC_KEY_PATH")
-
-	signBytes, err := ioutil.ReadFile(privKeyPath)
-	if err != nil {
+	if err := a.ReloadKeys(); err != nil {
 		log.WithFields(log.Fields{
-			"privateKeyPath": privKeyPath,
+			"keyDirectory":   viper.GetString("KEY_DIRECTORY"),
+			"privateKeyPath": viper.GetString("PRIVATE_KEY_PATH"),
+			"publicKeyPath":  viper.GetString("PUBLIC_KEY_PATH"),
 		}).Fatal(err)
 	}
+}
 
-	signKey, err = jwt.ParseRSAPrivateKeyFromPEM(signBytes)
-	if err != nil {
-		log.Fatal(err)
+// ReloadKeys reads the RSA keys from KEY_DIRECTORY, or the single keypair at PRIVATE_KEY_PATH and
+// PUBLIC_KEY_PATH when no directory is set. The current keys are kept if the new ones can't be loaded.
+func (a *Auth) ReloadKeys() error {
+	if dir := viper.GetString("KEY_DIRECTORY"); dir != "" {
+		return keyRing.LoadKeyDirectory(dir)
 	}
 
-	verifyBytes, err := ioutil.ReadFile(pubKeyPath)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"publiceKeyPath": pubKeyPath,
-		}).Fatal(err)
-	}
+	return keyRing.LoadKeyPair(viper.GetString("PRIVATE_KEY_PATH"), viper.GetString("PUBLIC_KEY_PATH"))
+}
 
-	verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
-	if err != nil {
-		log.Fatal(err)
-	}
+// JWKS returns the public keys JWTs can currently be verified with.
+func (a *Auth) JWKS() JWKSet {
+	return keyRing.JWKS()
 }
 
 // UserIsLoggedIn will read the JWT in the request header and verify that it is legitimate.
@@ -78,8 +100,19 @@ func (a *Auth) UserIsLoggedIn() gin.HandlerFunc {
 		}
 
 		if token.Valid {
-			// save token in context for use in other middleware
+			if a.tokenIsRevoked(token) {
+				c.JSON(http.StatusForbidden, gin.H{"err": ErrTokenRevoked.Error()})
+				c.Abort()
+				return
+			}
+
+			// save token and the user it belongs to in context for use in other middleware
 			c.Set("token", token)
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if id, ok := claims["id"].(string); ok {
+					c.Set("userID", id)
+				}
+			}
 		} else {
 			origin := c.GetHeader("Origin")
 			if ve, ok := err.(*jwt.ValidationError); ok {
@@ -101,28 +134,84 @@ func (a *Auth) UserIsLoggedIn() gin.HandlerFunc {
 	}
 }
 
-// UserIsInRole accepts a list of roles and determines whether a user's role in a JWT is in that list.
-func (a *Auth) UserIsInRole(d database.IDatabase, roles []constants.Role) gin.HandlerFunc {
+// UserIsActive looks up the logged in user's current role in the database, rather than trusting the role
+// in the JWT, and rejects users that are banned or haven't confirmed their account. The role is saved
+// in the context for use in other middleware.
+func (a *Auth) UserIsActive(d database.IDatabase) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var token interface{}
-		var ok bool
+		userID, ok := UserID(c)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"err": "Error accessing token"})
+			c.Abort()
+			return
+		}
+
+		user, err := d.GetUserByID(userID)
+		if err != nil {
+			log.WithFields(log.Fields{"userID": userID}).Error(err)
+			c.JSON(http.StatusForbidden, gin.H{"err": "Can't find that user"})
+			c.Abort()
+			return
+		}
+
+		role := constants.Role(user.UserRole)
+		if err := policy.CanRead(role); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"err": err.Error()})
+			c.Abort()
+			return
+		}
 
-		if token, ok = c.Get("token"); !ok {
+		sanctions, err := d.GetActiveSanctions(userID)
+		if err != nil {
+			log.WithFields(log.Fields{"userID": userID}).Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to check sanctions"})
+			c.Abort()
+			return
+		}
+
+		if ban, ok := FindSanction(sanctions, constants.SanctionBan); ok {
+			c.JSON(http.StatusForbidden, gin.H{"err": policy.ErrBanned.Error(), "sanction": ban.Notice()})
+			c.Abort()
+			return
+		}
+
+		c.Set("role", role)
+		c.Set("sanctions", sanctions)
+	}
+}
+
+// UserCanWrite rejects users whose role doesn't allow them to create content, such as muted users.
+func (a *Auth) UserCanWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := UserRole(c)
+		if !ok {
 			c.JSON(http.StatusForbidden, gin.H{"err": "Error accessing token"})
 			c.Abort()
 			return
 		}
 
-		var userRole constants.Role
-		if claims, ok := token.(jwt.Token).Claims.(jwt.MapClaims); ok {
-			userRole = constants.Role(claims["role"].(int))
-		} else {
+		if err := policy.CanWrite(role); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"err": err.Error()})
 			c.Abort()
 			return
 		}
 
-		for _, role := range roles {
-			if userRole == role {
+		if mute, ok := ActiveSanction(c, constants.SanctionMute); ok {
+			c.JSON(http.StatusForbidden, gin.H{"err": policy.ErrMuted.Error(), "sanction": mute.Notice()})
+			c.Abort()
+			return
+		}
+	}
+}
+
+// CategoryFunc finds the category a request is about, such as the category of the thread in the URL.
+type CategoryFunc func(c *gin.Context) (string, error)
+
+// RequirePermission rejects users whose role doesn't have at least one of the permissions.
+func (a *Auth) RequirePermission(d database.IDatabase, permissions ...constants.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, d, permission, "") {
 				return
 			}
 		}
@@ -132,18 +221,228 @@ func (a *Auth) UserIsInRole(d database.IDatabase, roles []constants.Role) gin.Ha
 	}
 }
 
+// RequireCategoryPermission rejects users whose role doesn't have the permission in the category the
+// request is about, taking that category's overrides into account. If the category can't be found the
+// role's permission everywhere else is checked, and the handler is left to report what's missing.
+func (a *Auth) RequireCategoryPermission(d database.IDatabase, permission constants.Permission, categoryOf CategoryFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, err := categoryOf(c)
+		if err != nil {
+			categoryID = ""
+		}
+
+		if !HasPermission(c, d, permission, categoryID) {
+			c.JSON(http.StatusForbidden, gin.H{"err": "User doesn't have access"})
+			c.Abort()
+		}
+	}
+}
+
 // CreateToken generates a signed JWT string based on user info.
 func (a *Auth) CreateToken(user model.User) (string, error) {
 	token := jwt.New(jwt.SigningMethodRS256)
 	claims := make(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix() // expires in one week
-	claims["iat"] = time.Now().Unix()
+	now := time.Now()
+	claims["exp"] = now.Add(AccessTokenLifetime).Unix()
+	claims["iat"] = now.Unix()
+	// iat only has whole-second precision, so keep the exact time to compare against RevokeUserTokens.
+	// It's a string since JSON numbers are decoded as float64, which can't hold a unix time in nanoseconds.
+	claims["iat_ns"] = strconv.FormatInt(now.UnixNano(), 10)
+	claims["jti"] = uuid.NewV4().String()
 	claims["user"] = user.Username
 	claims["id"] = user.ID
 	claims["role"] = user.UserRole
 	token.Claims = claims
 
-	return token.SignedString(signKey)
+	return keyRing.Sign(token)
+}
+
+// ParseToken validates a JWT the same way UserIsLoggedIn does, for connections like websockets that can't
+// send an Authorization header.
+func (a *Auth) ParseToken(tokenString string) (TokenUser, error) {
+	token, err := jwt.Parse(strings.Replace(tokenString, "Bearer ", "", 1), keyRing.VerifyKey)
+	if err != nil || !token.Valid {
+		return TokenUser{}, ErrInvalidToken
+	}
+
+	if a.tokenIsRevoked(token) {
+		return TokenUser{}, ErrTokenRevoked
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return TokenUser{}, ErrInvalidToken
+	}
+
+	id, _ := claims["id"].(string)
+	if id == "" {
+		return TokenUser{}, ErrInvalidToken
+	}
+
+	return TokenUser{ID: id, ExpiresAt: claimTime(claims, "exp")}, nil
+}
+
+// RevokeToken revokes the JWT that UserIsLoggedIn saved in the request context, so it can't be used again
+// before it expires.
+func (a *Auth) RevokeToken(c *gin.Context) error {
+	claims, ok := tokenClaims(c)
+	if !ok {
+		return errors.New("Error accessing token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" || a.Revocations == nil {
+		return nil
+	}
+
+	return a.Revocations.RevokeToken(jti, claimTime(claims, "exp"))
+}
+
+// RevokeUserTokens revokes every JWT issued to a user up until now.
+func (a *Auth) RevokeUserTokens(userID string) error {
+	if a.Revocations == nil {
+		return nil
+	}
+
+	return a.Revocations.RevokeUserTokens(userID, time.Now())
+}
+
+// UserRole returns the user's role, preferring the one UserIsActive loaded from the database over the
+// role claim of the JWT that UserIsLoggedIn saved in the request context.
+func UserRole(c *gin.Context) (constants.Role, bool) {
+	if role, ok := c.Get("role"); ok {
+		if r, ok := role.(constants.Role); ok {
+			return r, true
+		}
+	}
+
+	claims, ok := tokenClaims(c)
+	if !ok {
+		return constants.NeedsConfirmation, false
+	}
+
+	// JSON numbers in the claims are decoded as float64
+	role, ok := claims["role"].(float64)
+	if !ok {
+		return constants.NeedsConfirmation, false
+	}
+
+	return constants.Role(role), true
+}
+
+// HasPermission reports whether the user's role has a permission, in a category if one is given. Errors
+// looking it up are logged and the permission is refused.
+func HasPermission(c *gin.Context, d database.IDatabase, permission constants.Permission, categoryID string) bool {
+	role, ok := UserRole(c)
+	if !ok {
+		return false
+	}
+
+	allowed, err := d.HasPermission(role, permission, categoryID)
+	if err != nil {
+		log.WithFields(log.Fields{"permission": permission, "categoryID": categoryID}).Error(err)
+		return false
+	}
+
+	return allowed
+}
+
+// UserID returns the ID of the user whose JWT UserIsLoggedIn validated.
+func UserID(c *gin.Context) (string, bool) {
+	id, ok := c.Get("userID")
+	if !ok {
+		return "", false
+	}
+
+	userID, ok := id.(string)
+	return userID, ok && userID != ""
+}
+
+// ActiveSanction returns the first of the user's active sanctions of one of the given types. Sanctions
+// are loaded by UserIsActive.
+func ActiveSanction(c *gin.Context, types ...constants.SanctionType) (model.Sanction, bool) {
+	value, ok := c.Get("sanctions")
+	if !ok {
+		return model.Sanction{}, false
+	}
+
+	sanctions, _ := value.([]model.Sanction)
+	return FindSanction(sanctions, types...)
+}
+
+// FindSanction returns the first sanction of one of the given types.
+func FindSanction(sanctions []model.Sanction, types ...constants.SanctionType) (model.Sanction, bool) {
+	for _, s := range sanctions {
+		for _, t := range types {
+			if s.Type == string(t) {
+				return s, true
+			}
+		}
+	}
+
+	return model.Sanction{}, false
+}
+
+func tokenClaims(c *gin.Context) (jwt.MapClaims, bool) {
+	token, ok := c.Get("token")
+	if !ok {
+		return nil, false
+	}
+
+	t, ok := token.(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// tokenIsRevoked checks whether a token's jti has been revoked, or it was issued before its user revoked
+// all of their tokens. Errors from the revocation store are logged and the token is allowed.
+func (a *Auth) tokenIsRevoked(token *jwt.Token) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || a.Revocations == nil {
+		return false
+	}
+
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := a.Revocations.IsTokenRevoked(jti)
+		if err != nil {
+			log.Error(err)
+		} else if revoked {
+			return true
+		}
+	}
+
+	if userID, ok := claims["id"].(string); ok {
+		revokedAt, err := a.Revocations.UserTokensRevokedAt(userID)
+		if err != nil {
+			log.Error(err)
+		} else if !revokedAt.IsZero() && !issuedAt(claims).After(revokedAt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimTime reads a unix timestamp claim, which is decoded from JSON as a float64.
+func claimTime(claims jwt.MapClaims, key string) time.Time {
+	seconds, _ := claims[key].(float64)
+	return time.Unix(int64(seconds), 0)
+}
+
+// issuedAt reads when a token was issued to the nanosecond, falling back to its iat for tokens without
+// iat_ns. Those only have whole-second precision, so they count as revoked in the same second as a revocation.
+func issuedAt(claims jwt.MapClaims) time.Time {
+	if ns, ok := claims["iat_ns"].(string); ok {
+		if nanoseconds, err := strconv.ParseInt(ns, 10, 64); err == nil {
+			return time.Unix(0, nanoseconds)
+		}
+	}
+
+	return claimTime(claims, "iat")
 }
 
 func (a *Auth) getToken(c *gin.Context) (*jwt.Token, error) {
@@ -158,9 +457,7 @@ func (a *Auth) getToken(c *gin.Context) (*jwt.Token, error) {
 
 	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return verifyKey, nil
-	})
+	token, err := jwt.Parse(tokenString, keyRing.VerifyKey)
 
 	return token, err
 }
@@ -170,4 +467,6 @@ func (a *Auth) setUpViper() {
 	viper.SetDefault("PUBLIC_KEY_PATH", "/var/bored-board-service/.keys/app.rsa.pub")
 	viper.BindEnv("PRIVATE_KEY_PATH")
 	viper.BindEnv("PUBLIC_KEY_PATH")
+	viper.BindEnv("KEY_DIRECTORY")
+	viper.BindEnv(constants.SecretKeyEnvVariable, constants.SecretKeyEnvVariable)
 }
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestKey(t, dir, "app")
+	if err = keyRing.LoadKeyDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Auth{Revocations: NewMemoryRevocationStore()}
+	tokenString, err := a.CreateToken(model.User{ID: "1", Username: "hsimpson"})
+	assert.Nil(t, err)
+
+	user, err := a.ParseToken("Bearer " + tokenString)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", user.ID)
+	assert.False(t, user.ExpiresAt.IsZero())
+
+	_, err = a.ParseToken("nonsense")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	a.Revocations.RevokeUserTokens("1", user.ExpiresAt)
+	_, err = a.ParseToken(tokenString)
+	assert.Equal(t, ErrTokenRevoked, err)
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	privateKeyExtension = ".rsa"
+	publicKeyExtension  = ".rsa.pub"
+	retiredExtension    = ".retired"
+)
+
+// ErrNoSigningKey occurs when a key ring is loaded without any private key to sign tokens with
+var ErrNoSigningKey = errors.New("No private key found to sign tokens with")
+
+// ErrUnknownKey occurs when a token is signed with a key that isn't in the key ring, or has been retired
+var ErrUnknownKey = errors.New("Token was signed with an unknown key")
+
+// KeyRing holds every RSA key tokens can be verified with, and the key new tokens are signed with.
+//
+// Keys are loaded from a directory, where the file name without its extension is the key's kid:
+// <kid>.rsa is a private key, <kid>.rsa.pub is a public key, and an empty <kid>.retired file retires
+// a key so tokens signed with it are no longer accepted. New tokens are signed with the private key
+// whose kid sorts last, so kids like 2019-06 make rotation a matter of adding a newer key.
+type KeyRing struct {
+	mu         sync.RWMutex
+	signingKID string
+	signingKey *rsa.PrivateKey
+	verifyKeys map[string]*rsa.PublicKey
+}
+
+// JWK is the JSON Web Key representation of an RSA public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeyDirectory replaces the keys in the ring with the ones in a directory. If the directory can't
+// be loaded the ring keeps the keys it had.
+func (k *KeyRing) LoadKeyDirectory(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	retired := make(map[string]bool)
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), retiredExtension) {
+			retired[strings.TrimSuffix(f.Name(), retiredExtension)] = true
+		}
+	}
+
+	privateKeys := make(map[string]*rsa.PrivateKey)
+	verifyKeys := make(map[string]*rsa.PublicKey)
+	for _, f := range files {
+		name := f.Name()
+		path := filepath.Join(dir, name)
+
+		switch {
+		case strings.HasSuffix(name, publicKeyExtension):
+			kid := strings.TrimSuffix(name, publicKeyExtension)
+			if retired[kid] {
+				continue
+			}
+
+			key, err := readPublicKey(path)
+			if err != nil {
+				return err
+			}
+			verifyKeys[kid] = key
+		case strings.HasSuffix(name, privateKeyExtension):
+			kid := strings.TrimSuffix(name, privateKeyExtension)
+			if retired[kid] {
+				continue
+			}
+
+			key, err := readPrivateKey(path)
+			if err != nil {
+				return err
+			}
+			privateKeys[kid] = key
+		}
+	}
+
+	kids := make([]string, 0, len(privateKeys))
+	for kid, key := range privateKeys {
+		kids = append(kids, kid)
+		if _, ok := verifyKeys[kid]; !ok {
+			verifyKeys[kid] = &key.PublicKey
+		}
+	}
+	if len(kids) == 0 {
+		return ErrNoSigningKey
+	}
+	sort.Strings(kids)
+	signingKID := kids[len(kids)-1]
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.signingKID = signingKID
+	k.signingKey = privateKeys[signingKID]
+	k.verifyKeys = verifyKeys
+
+	return nil
+}
+
+// LoadKeyPair replaces the keys in the ring with a single keypair, using the private key's file name
+// without its extension as the kid.
+func (k *KeyRing) LoadKeyPair(privateKeyPath string, publicKeyPath string) error {
+	signingKey, err := readPrivateKey(privateKeyPath)
+	if err != nil {
+		return err
+	}
+
+	verifyKey, err := readPublicKey(publicKeyPath)
+	if err != nil {
+		return err
+	}
+
+	kid := strings.TrimSuffix(filepath.Base(privateKeyPath), filepath.Ext(privateKeyPath))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.signingKID = kid
+	k.signingKey = signingKey
+	k.verifyKeys = map[string]*rsa.PublicKey{kid: verifyKey}
+
+	return nil
+}
+
+// Sign signs a token with the current signing key, stamping its kid in the header.
+func (k *KeyRing) Sign(token *jwt.Token) (string, error) {
+	k.mu.RLock()
+	kid, key := k.signingKID, k.signingKey
+	k.mu.RUnlock()
+
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// VerifyKey finds the public key a token was signed with, for use as a jwt.Keyfunc. Tokens without a
+// kid were issued before keys had one, and are checked against the current signing key.
+func (k *KeyRing) VerifyKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = k.signingKID
+	}
+
+	key, ok := k.verifyKeys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// JWKS returns the public keys tokens can currently be verified with.
+func (k *KeyRing) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(k.verifyKeys))}
+	for kid, key := range k.verifyKeys {
+		set.Keys = append(set.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
+
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return key, nil
+}
+
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParseRSAPublicKeyFromPEM(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestKey(t *testing.T, dir string, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = ioutil.WriteFile(filepath.Join(dir, kid+privateKeyExtension), privateKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestKey(t, dir, "2019-01")
+	k := &KeyRing{}
+	assert.Nil(t, k.LoadKeyDirectory(dir))
+
+	oldToken, err := k.Sign(jwt.New(jwt.SigningMethodRS256))
+	assert.Nil(t, err)
+
+	writeTestKey(t, dir, "2019-06")
+	assert.Nil(t, k.LoadKeyDirectory(dir))
+
+	token := jwt.New(jwt.SigningMethodRS256)
+	newToken, err := k.Sign(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "2019-06", token.Header["kid"])
+	assert.Len(t, k.JWKS().Keys, 2)
+
+	// Tokens signed with the previous key are still accepted until it's retired
+	_, err = jwt.Parse(oldToken, k.VerifyKey)
+	assert.Nil(t, err)
+	_, err = jwt.Parse(newToken, k.VerifyKey)
+	assert.Nil(t, err)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "2019-01"+retiredExtension), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, k.LoadKeyDirectory(dir))
+
+	_, err = jwt.Parse(oldToken, k.VerifyKey)
+	assert.NotNil(t, err)
+	assert.Len(t, k.JWKS().Keys, 1)
+}
+
+func TestKeyRingKeepsKeysWhenReloadFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestKey(t, dir, "app")
+	k := &KeyRing{}
+	assert.Nil(t, k.LoadKeyDirectory(dir))
+
+	assert.NotNil(t, k.LoadKeyDirectory(filepath.Join(dir, "missing")))
+	empty, _ := ioutil.TempDir("", "keys")
+	defer os.RemoveAll(empty)
+	assert.Equal(t, ErrNoSigningKey, k.LoadKeyDirectory(empty))
+
+	_, err = k.Sign(jwt.New(jwt.SigningMethodRS256))
+	assert.Nil(t, err)
+	assert.Equal(t, "app", k.JWKS().Keys[0].Kid)
+}
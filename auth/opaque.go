@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/spf13/viper"
+)
+
+// NewOpaqueToken generates a random token to hand to a user, such as a password reset or refresh token,
+// along with the signed hash of it that should be stored. The token itself is never stored.
+func NewOpaqueToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken signs a token with the server's secret key so it can be looked up without storing
+// the token itself.
+func HashOpaqueToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(viper.GetString(constants.SecretKeyEnvVariable)))
+	mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
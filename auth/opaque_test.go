@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOpaqueToken(t *testing.T) {
+	token, hash, err := NewOpaqueToken()
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, HashOpaqueToken(token))
+
+	other, _, _ := NewOpaqueToken()
+	assert.NotEqual(t, token, other)
+}
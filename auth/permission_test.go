@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDatabase struct {
+	database.IDatabase
+	permissions map[string]bool
+}
+
+func (f *fakeDatabase) HasPermission(r constants.Role, p constants.Permission, categoryID string) (bool, error) {
+	if allowed, ok := f.permissions[categoryID+"/"+string(p)]; ok {
+		return allowed, nil
+	}
+	return f.permissions["/"+string(p)], nil
+}
+
+func permissionContext(role constants.Role) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("role", role)
+	return c, w
+}
+
+func TestRequirePermission(t *testing.T) {
+	a := &Auth{}
+	d := &fakeDatabase{permissions: map[string]bool{"/user.mute": true}}
+
+	c, _ := permissionContext(constants.Mod)
+	a.RequirePermission(d, constants.PermUserBan, constants.PermUserMute)(c)
+	assert.False(t, c.IsAborted())
+
+	c, w := permissionContext(constants.Mod)
+	a.RequirePermission(d, constants.PermUserBan)(c)
+	assert.True(t, c.IsAborted())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRequireCategoryPermission(t *testing.T) {
+	a := &Auth{}
+	d := &fakeDatabase{permissions: map[string]bool{"/thread.delete": true, "5/thread.delete": false}}
+	categoryOf := func(id string) CategoryFunc {
+		return func(c *gin.Context) (string, error) {
+			return id, nil
+		}
+	}
+
+	c, _ := permissionContext(constants.Mod)
+	a.RequireCategoryPermission(d, constants.PermThreadDelete, categoryOf("4"))(c)
+	assert.False(t, c.IsAborted())
+
+	c, _ = permissionContext(constants.Mod)
+	a.RequireCategoryPermission(d, constants.PermThreadDelete, categoryOf("5"))(c)
+	assert.True(t, c.IsAborted())
+}
+
+func TestUserRoleFromClaims(t *testing.T) {
+	c, _ := permissionContext(constants.User)
+	c.Keys = nil
+	c.Set("token", &jwt.Token{Claims: jwt.MapClaims{"role": float64(constants.Mod)}})
+
+	role, ok := UserRole(c)
+	assert.True(t, ok)
+	assert.Equal(t, constants.Mod, role)
+}
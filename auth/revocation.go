@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// RevocationStore keeps track of access tokens that were revoked before they expired.
+type RevocationStore interface {
+	// RevokeToken denylists the token with the given jti until it would have expired anyway.
+	RevokeToken(jti string, expires time.Time) error
+	// IsTokenRevoked reports whether the token with the given jti has been revoked.
+	IsTokenRevoked(jti string) (bool, error)
+	// RevokeUserTokens revokes every token issued to a user up to and including now.
+	RevokeUserTokens(userID string, now time.Time) error
+	// UserTokensRevokedAt returns when the user last revoked all their tokens, to the nanosecond, or the
+	// zero time.
+	UserTokensRevokedAt(userID string) (time.Time, error)
+}
+
+// NewRevocationStore creates a store backed by Redis that falls back to keeping revocations in memory
+// when Redis can't be reached.
+func NewRevocationStore(pool *redis.Pool) RevocationStore {
+	return &fallbackRevocationStore{
+		redis:  &RedisRevocationStore{Pool: pool},
+		memory: NewMemoryRevocationStore(),
+	}
+}
+
+// RedisRevocationStore keeps revocations in Redis, so they're shared by every instance of the service.
+type RedisRevocationStore struct {
+	Pool *redis.Pool
+}
+
+// RevokeToken denylists the token with the given jti until it would have expired anyway.
+func (r *RedisRevocationStore) RevokeToken(jti string, expires time.Time) error {
+	ttl := int(time.Until(expires).Seconds()) + 1
+	if ttl <= 0 {
+		return nil
+	}
+
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", "revoked:jti:"+jti, 1, "EX", ttl)
+	return err
+}
+
+// IsTokenRevoked reports whether the token with the given jti has been revoked.
+func (r *RedisRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	return redis.Bool(conn.Do("EXISTS", "revoked:jti:"+jti))
+}
+
+// RevokeUserTokens revokes every token issued to a user up to and including now.
+func (r *RedisRevocationStore) RevokeUserTokens(userID string, now time.Time) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", "revoked:user:"+userID, now.UnixNano(), "EX", int(AccessTokenLifetime.Seconds())+1)
+	return err
+}
+
+// UserTokensRevokedAt returns when the user last revoked all their tokens, or the zero time.
+func (r *RedisRevocationStore) UserTokensRevokedAt(userID string) (time.Time, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	revokedAt, err := redis.Int64(conn.Do("GET", "revoked:user:"+userID))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, revokedAt), nil
+}
+
+// MemoryRevocationStore keeps revocations in memory, which only works for a single instance of the service.
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates an empty in-memory revocation store.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// RevokeToken denylists the token with the given jti until it would have expired anyway.
+func (m *MemoryRevocationStore) RevokeToken(jti string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	m.tokens[jti] = expires
+	return nil
+}
+
+// IsTokenRevoked reports whether the token with the given jti has been revoked.
+func (m *MemoryRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires, ok := m.tokens[jti]
+	return ok && time.Now().Before(expires), nil
+}
+
+// RevokeUserTokens revokes every token issued to a user up to and including now.
+func (m *MemoryRevocationStore) RevokeUserTokens(userID string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	m.users[userID] = now
+	return nil
+}
+
+// UserTokensRevokedAt returns when the user last revoked all their tokens, or the zero time.
+func (m *MemoryRevocationStore) UserTokensRevokedAt(userID string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.users[userID], nil
+}
+
+// prune drops revocations for tokens that have expired by now. Callers must hold the lock.
+func (m *MemoryRevocationStore) prune() {
+	now := time.Now()
+	for jti, expires := range m.tokens {
+		if now.After(expires) {
+			delete(m.tokens, jti)
+		}
+	}
+	for userID, revokedAt := range m.users {
+		if now.Sub(revokedAt) > AccessTokenLifetime {
+			delete(m.users, userID)
+		}
+	}
+}
+
+// fallbackRevocationStore writes revocations to both stores and reads from Redis, using the in-memory
+// store whenever Redis returns an error.
+type fallbackRevocationStore struct {
+	redis  RevocationStore
+	memory RevocationStore
+}
+
+func (f *fallbackRevocationStore) RevokeToken(jti string, expires time.Time) error {
+	f.memory.RevokeToken(jti, expires)
+	if err := f.redis.RevokeToken(jti, expires); err != nil {
+		logRedisFallback(err)
+	}
+	return nil
+}
+
+func (f *fallbackRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	revoked, err := f.redis.IsTokenRevoked(jti)
+	if err != nil {
+		logRedisFallback(err)
+		return f.memory.IsTokenRevoked(jti)
+	}
+	if !revoked {
+		return f.memory.IsTokenRevoked(jti)
+	}
+	return true, nil
+}
+
+func (f *fallbackRevocationStore) RevokeUserTokens(userID string, now time.Time) error {
+	f.memory.RevokeUserTokens(userID, now)
+	if err := f.redis.RevokeUserTokens(userID, now); err != nil {
+		logRedisFallback(err)
+	}
+	return nil
+}
+
+func (f *fallbackRevocationStore) UserTokensRevokedAt(userID string) (time.Time, error) {
+	memoryRevokedAt, _ := f.memory.UserTokensRevokedAt(userID)
+
+	revokedAt, err := f.redis.UserTokensRevokedAt(userID)
+	if err != nil {
+		logRedisFallback(err)
+		return memoryRevokedAt, nil
+	}
+
+	if memoryRevokedAt.After(revokedAt) {
+		return memoryRevokedAt, nil
+	}
+	return revokedAt, nil
+}
+
+func logRedisFallback(err error) {
+	log.WithFields(log.Fields{
+		"error": err,
+	}).Warn("Error reaching Redis for token revocation, using in-memory store")
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type unreachableRevocationStore struct {
+	RevocationStore
+}
+
+func (u unreachableRevocationStore) RevokeToken(jti string, expires time.Time) error {
+	return errors.New("connection refused")
+}
+
+func (u unreachableRevocationStore) IsTokenRevoked(jti string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	m := NewMemoryRevocationStore()
+
+	m.RevokeToken("current", time.Now().Add(time.Minute))
+	m.RevokeToken("expired", time.Now().Add(-time.Minute))
+
+	revoked, _ := m.IsTokenRevoked("current")
+	assert.True(t, revoked)
+	revoked, _ = m.IsTokenRevoked("expired")
+	assert.False(t, revoked)
+	revoked, _ = m.IsTokenRevoked("unknown")
+	assert.False(t, revoked)
+
+	now := time.Now()
+	m.RevokeUserTokens("1", now)
+	revokedAt, _ := m.UserTokensRevokedAt("1")
+	assert.True(t, now.Equal(revokedAt))
+	revokedAt, _ = m.UserTokensRevokedAt("2")
+	assert.True(t, revokedAt.IsZero())
+}
+
+func TestFallbackRevocationStoreWithoutRedis(t *testing.T) {
+	f := &fallbackRevocationStore{
+		redis:  unreachableRevocationStore{},
+		memory: NewMemoryRevocationStore(),
+	}
+
+	assert.Nil(t, f.RevokeToken("jti", time.Now().Add(time.Minute)))
+
+	revoked, err := f.IsTokenRevoked("jti")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+}
+
+// fakeRedisConn answers the GET and SET commands the revocation store uses from a map.
+type fakeRedisConn struct {
+	values map[string]interface{}
+}
+
+func (f *fakeRedisConn) Close() error { return nil }
+func (f *fakeRedisConn) Err() error   { return nil }
+func (f *fakeRedisConn) Send(cmd string, args ...interface{}) error {
+	_, err := f.Do(cmd, args...)
+	return err
+}
+func (f *fakeRedisConn) Flush() error                  { return nil }
+func (f *fakeRedisConn) Receive() (interface{}, error) { return nil, nil }
+
+func (f *fakeRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	switch cmd {
+	case "SET":
+		f.values[args[0].(string)] = args[1]
+		return "OK", nil
+	case "GET":
+		return f.values[args[0].(string)], nil
+	}
+	return nil, nil
+}
+
+// sameSecondRevocation checks tokens issued before "log out everywhere" are revoked and tokens issued after
+// it aren't, even within the same second, while tokens without iat_ns are revoked for that whole second.
+func sameSecondRevocation(t *testing.T, store RevocationStore) {
+	a := &Auth{Revocations: store}
+	second := time.Now().Truncate(time.Second)
+	token := func(issued time.Time) *jwt.Token {
+		return &jwt.Token{Claims: jwt.MapClaims{
+			"id":     "1",
+			"iat":    float64(issued.Unix()),
+			"iat_ns": strconv.FormatInt(issued.UnixNano(), 10),
+		}}
+	}
+	legacyToken := func(issued time.Time) *jwt.Token {
+		return &jwt.Token{Claims: jwt.MapClaims{"id": "1", "iat": float64(issued.Unix())}}
+	}
+
+	assert.Nil(t, store.RevokeUserTokens("1", second.Add(500*time.Millisecond)))
+
+	assert.True(t, a.tokenIsRevoked(token(second.Add(-time.Second))))
+	assert.True(t, a.tokenIsRevoked(token(second.Add(100*time.Millisecond))))
+	assert.True(t, a.tokenIsRevoked(token(second.Add(500*time.Millisecond))))
+	assert.False(t, a.tokenIsRevoked(token(second.Add(500*time.Millisecond+time.Nanosecond))))
+	assert.False(t, a.tokenIsRevoked(token(second.Add(900*time.Millisecond))))
+
+	assert.True(t, a.tokenIsRevoked(legacyToken(second.Add(900*time.Millisecond))))
+	assert.False(t, a.tokenIsRevoked(legacyToken(second.Add(time.Second))))
+}
+
+func TestMemoryRevocationStoreSameSecond(t *testing.T) {
+	sameSecondRevocation(t, NewMemoryRevocationStore())
+}
+
+func TestRedisRevocationStoreSameSecond(t *testing.T) {
+	conn := &fakeRedisConn{values: make(map[string]interface{})}
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }}
+
+	sameSecondRevocation(t, &RedisRevocationStore{Pool: pool})
+}
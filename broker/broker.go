@@ -0,0 +1,214 @@
+package broker
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnknownBroker occurs when the configured broker isn't one we know how to create
+var ErrUnknownBroker = errors.New("Unknown broker")
+
+// ErrClosed occurs when a broker is used after it was closed
+var ErrClosed = errors.New("Broker has been closed")
+
+// healthCheck is how often a Redis subscription is pinged, to notice connections that died quietly.
+const healthCheck = 30 * time.Second
+
+// Message is something published on a topic.
+type Message struct {
+	Topic string
+	Data  []byte
+}
+
+// Broker passes messages published by any server on to every server subscribed to the topic.
+type Broker interface {
+	// Publish sends a message to everyone subscribed to the topic.
+	Publish(topic string, data []byte) error
+	// Subscribe calls handle with every message published on a topic matching one of the glob patterns.
+	// It blocks until the subscription fails or the broker is closed, and the caller is expected to
+	// subscribe again if it still wants messages.
+	Subscribe(patterns []string, handle func(Message)) error
+	Close() error
+}
+
+// New creates the broker named by kind, either redis or memory. The pool is only used by the Redis broker.
+func New(kind string, pool *redis.Pool) (Broker, error) {
+	switch kind {
+	case "redis":
+		return NewRedisBroker(pool), nil
+	case "memory":
+		return NewMemoryBroker(), nil
+	default:
+		return nil, ErrUnknownBroker
+	}
+}
+
+// RedisBroker shares messages between every server connected to the same Redis.
+type RedisBroker struct {
+	Pool *redis.Pool
+}
+
+// NewRedisBroker creates a broker that publishes with connections from the pool.
+func NewRedisBroker(pool *redis.Pool) *RedisBroker {
+	return &RedisBroker{Pool: pool}
+}
+
+// Publish sends a message to everyone subscribed to the topic.
+func (r *RedisBroker) Publish(topic string, data []byte) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", topic, data)
+	return err
+}
+
+// Subscribe calls handle with every message published on a topic matching one of the glob patterns,
+// until the connection to Redis fails.
+func (r *RedisBroker) Subscribe(patterns []string, handle func(Message)) error {
+	conn, err := r.Pool.Dial()
+	if err != nil {
+		return err
+	}
+
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	args := make([]interface{}, len(patterns))
+	for i, pattern := range patterns {
+		args[i] = pattern
+	}
+	if err = psc.PSubscribe(args...); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(healthCheck)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * healthCheck).(type) {
+		case redis.PMessage:
+			handle(Message{Topic: v.Channel, Data: v.Data})
+		case redis.Subscription:
+			log.WithFields(log.Fields{"pattern": v.Channel}).Debug("Subscribed to Redis channel")
+		case error:
+			return v
+		}
+	}
+}
+
+// Close closes the pool.
+func (r *RedisBroker) Close() error {
+	return r.Pool.Close()
+}
+
+// MemoryBroker passes messages between subscribers in the same process, for running a single server
+// without Redis.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[*memorySubscriber]bool
+	closed      chan struct{}
+}
+
+type memorySubscriber struct {
+	patterns []string
+	messages chan Message
+}
+
+// NewMemoryBroker creates a broker with no subscribers.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[*memorySubscriber]bool),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Publish sends a message to every subscriber with a matching pattern. Subscribers that have fallen too
+// far behind miss the message rather than holding up the publisher.
+func (m *MemoryBroker) Publish(topic string, data []byte) error {
+	select {
+	case <-m.closed:
+		return ErrClosed
+	default:
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for sub := range m.subscribers {
+		if !sub.matches(topic) {
+			continue
+		}
+
+		select {
+		case sub.messages <- Message{Topic: topic, Data: data}:
+		default:
+			log.WithFields(log.Fields{"topic": topic}).Warn("Subscriber is too slow, dropping message")
+		}
+	}
+
+	return nil
+}
+
+// Subscribe calls handle with every message published on a topic matching one of the glob patterns,
+// until the broker is closed.
+func (m *MemoryBroker) Subscribe(patterns []string, handle func(Message)) error {
+	sub := &memorySubscriber{patterns: patterns, messages: make(chan Message, 256)}
+
+	m.mu.Lock()
+	m.subscribers[sub] = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.subscribers, sub)
+		m.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case message := <-sub.messages:
+			handle(message)
+		case <-m.closed:
+			return ErrClosed
+		}
+	}
+}
+
+// Close stops every subscription.
+func (m *MemoryBroker) Close() error {
+	select {
+	case <-m.closed:
+	default:
+		close(m.closed)
+	}
+	return nil
+}
+
+func (s *memorySubscriber) matches(topic string) bool {
+	for _, pattern := range s.patterns {
+		if ok, _ := path.Match(pattern, topic); ok {
+			return true
+		}
+	}
+	return false
+}
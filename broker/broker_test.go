@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := NewMemoryBroker()
+	received := make(chan Message, 10)
+
+	done := make(chan error)
+	go func() {
+		done <- b.Subscribe([]string{"thread:*", "threads-index"}, func(m Message) {
+			received <- m
+		})
+	}()
+
+	// Wait for the subscription to be registered before publishing
+	for {
+		b.mu.RLock()
+		n := len(b.subscribers)
+		b.mu.RUnlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Nil(t, b.Publish("message:1", []byte("private")))
+	assert.Nil(t, b.Publish("thread:1", []byte("post")))
+	assert.Nil(t, b.Publish("threads-index", []byte("thread")))
+
+	assert.Equal(t, Message{Topic: "thread:1", Data: []byte("post")}, <-received)
+	assert.Equal(t, Message{Topic: "threads-index", Data: []byte("thread")}, <-received)
+
+	b.Close()
+	assert.Equal(t, ErrClosed, <-done)
+	assert.Equal(t, ErrClosed, b.Publish("thread:1", nil))
+	assert.Len(t, received, 0)
+}
+
+func TestNew(t *testing.T) {
+	b, err := New("memory", nil)
+	assert.Nil(t, err)
+	assert.IsType(t, &MemoryBroker{}, b)
+
+	_, err = New("carrier pigeon", nil)
+	assert.Equal(t, ErrUnknownBroker, err)
+}
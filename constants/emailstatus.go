@@ -0,0 +1,9 @@
+package constants
+
+type EmailStatus string
+
+const (
+	EmailPending EmailStatus = "pending"
+	EmailSent    EmailStatus = "sent"
+	EmailDead    EmailStatus = "dead"
+)
@@ -14,14 +14,23 @@ limitations under the License. */
 package constants
 
 const (
-	EnvironmentVariablePrefix    string = "BBS"
-	RegistrationEmailEnvVariable string = "REGISTRATION_EMAIL_TEMPLATE_ID"
-	SendGridAPIKeyEnvVariable    string = "SENDGRID_API_KEY"
-	EmailFromAddressEnvVariable  string = "EMAIL_FROM_ADDRESS"
-	EmailFromNameEnvVariable     string = "EMAIL_FROM_NAME"
-	BoardURLVerifyEnvVariable    string = "BOARD_URL_VERIFY"
-	BoardURLDonateEnvVariable    string = "BOARD_URL_DONATE"
-	BoardURLCorsEnvVariable      string = "BOARD_URL_CORS"
-	BoardSendNewUserEmailSubject string = "BOARD_SEND_NEW_USER_EMAIL_SUBJECT"
-	RedisURLEnvVariable          string = "REDIS_URL"
+	EnvironmentVariablePrefix     string = "BBS"
+	MailerEnvVariable             string = "MAILER"
+	SendGridAPIKeyEnvVariable     string = "SENDGRID_API_KEY"
+	SMTPHostEnvVariable           string = "SMTP_HOST"
+	SMTPPortEnvVariable           string = "SMTP_PORT"
+	SMTPUsernameEnvVariable       string = "SMTP_USERNAME"
+	SMTPPasswordEnvVariable       string = "SMTP_PASSWORD"
+	MailDirectoryEnvVariable      string = "MAIL_DIRECTORY"
+	EmailFromAddressEnvVariable   string = "EMAIL_FROM_ADDRESS"
+	EmailFromNameEnvVariable      string = "EMAIL_FROM_NAME"
+	BoardURLVerifyEnvVariable     string = "BOARD_URL_VERIFY"
+	BoardURLDonateEnvVariable     string = "BOARD_URL_DONATE"
+	BoardURLCorsEnvVariable       string = "BOARD_URL_CORS"
+	BoardSendNewUserEmailSubject  string = "BOARD_SEND_NEW_USER_EMAIL_SUBJECT"
+	RedisURLEnvVariable           string = "REDIS_URL"
+	BrokerEnvVariable             string = "BROKER"
+	SecretKeyEnvVariable          string = "SECRET_KEY"
+	BoardURLResetEnvVariable      string = "BOARD_URL_RESET"
+	BoardSendPasswordResetSubject string = "BOARD_SEND_PASSWORD_RESET_SUBJECT"
 )
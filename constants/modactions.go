@@ -0,0 +1,31 @@
+package constants
+
+type ModAction string
+
+const (
+	ModThreadDelete    ModAction = "thread.delete"
+	ModThreadRestore   ModAction = "thread.restore"
+	ModPostDelete      ModAction = "post.delete"
+	ModPostRestore     ModAction = "post.restore"
+	ModPostEdit        ModAction = "post.edit"
+	ModUserRole        ModAction = "user.role"
+	ModUserMute        ModAction = "user.mute"
+	ModUserBan         ModAction = "user.ban"
+	ModSanctionLift    ModAction = "sanction.lift"
+	ModCategoryCreate  ModAction = "category.create"
+	ModCategoryReorder ModAction = "category.reorder"
+	ModCategoryArchive ModAction = "category.archive"
+	ModPermissions     ModAction = "permissions.change"
+)
+
+// ModTarget is the type of thing a mod action was taken on. Most targets are identified by their UUID, but
+// roles are identified by their number.
+type ModTarget string
+
+const (
+	ModTargetThread   ModTarget = "thread"
+	ModTargetPost     ModTarget = "post"
+	ModTargetUser     ModTarget = "user"
+	ModTargetCategory ModTarget = "category"
+	ModTargetRole     ModTarget = "role"
+)
@@ -0,0 +1,10 @@
+package constants
+
+type NotificationType string
+
+const (
+	NotificationReply     NotificationType = "reply"
+	NotificationMessage   NotificationType = "message"
+	NotificationMention   NotificationType = "mention"
+	NotificationModAction NotificationType = "mod_action"
+)
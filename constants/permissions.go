@@ -0,0 +1,28 @@
+package constants
+
+type Permission string
+
+const (
+	PermThreadDelete     Permission = "thread.delete"
+	PermThreadRestore    Permission = "thread.restore"
+	PermPostDelete       Permission = "post.delete"
+	PermPostRestore      Permission = "post.restore"
+	PermPostEditAny      Permission = "post.edit.any"
+	PermUserMute         Permission = "user.mute"
+	PermUserBan          Permission = "user.ban"
+	PermUserRole         Permission = "user.role"
+	PermReportManage     Permission = "report.manage"
+	PermCategoryManage   Permission = "category.manage"
+	PermModLogView       Permission = "modlog.view"
+	PermEmailManage      Permission = "email.manage"
+	PermPermissionManage Permission = "permission.manage"
+)
+
+// Permissions are every permission that can be given to a role.
+var Permissions = []Permission{PermThreadDelete, PermThreadRestore, PermPostDelete, PermPostRestore, PermPostEditAny,
+	PermUserMute, PermUserBan, PermUserRole, PermReportManage, PermCategoryManage, PermModLogView, PermEmailManage,
+	PermPermissionManage}
+
+// CategoryPermissions are the permissions that can be granted or taken away from a role in a single category.
+var CategoryPermissions = []Permission{PermThreadDelete, PermThreadRestore, PermPostDelete, PermPostRestore,
+	PermPostEditAny, PermCategoryManage}
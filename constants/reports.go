@@ -0,0 +1,31 @@
+package constants
+
+type ReportReason string
+
+const (
+	ReportSpam       ReportReason = "spam"
+	ReportHarassment ReportReason = "harassment"
+	ReportOffensive  ReportReason = "offensive"
+	ReportOffTopic   ReportReason = "off_topic"
+	ReportOther      ReportReason = "other"
+)
+
+// ReportReasons are the reasons a post can be reported for.
+var ReportReasons = []ReportReason{ReportSpam, ReportHarassment, ReportOffensive, ReportOffTopic, ReportOther}
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportDismissed ReportStatus = "dismissed"
+	ReportResolved  ReportStatus = "resolved"
+)
+
+type ReportAction string
+
+const (
+	ReportDismiss    ReportAction = "dismiss"
+	ReportDeletePost ReportAction = "delete_post"
+	ReportMuteAuthor ReportAction = "mute_author"
+	ReportBanAuthor  ReportAction = "ban_author"
+)
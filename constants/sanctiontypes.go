@@ -0,0 +1,8 @@
+package constants
+
+type SanctionType string
+
+const (
+	SanctionMute SanctionType = "mute"
+	SanctionBan  SanctionType = "ban"
+)
@@ -11,3 +11,37 @@ const (
 	Banned            Role = 5
 	NeedsConfirmation Role = 6
 )
+
+// AccessLevel returns the role used when checking read access. A muted user keeps the read access
+// of a regular user.
+func (r Role) AccessLevel() Role {
+	if r == Muted {
+		return User
+	}
+	return r
+}
+
+// HasAccess reports whether a user with this role can see content restricted to the required role.
+// Roles are ordered from Admin down to User, so a lower value has more access.
+func (r Role) HasAccess(required Role) bool {
+	level := r.AccessLevel()
+	return level <= User && level <= required
+}
+
+var roleNames = map[Role]string{
+	Admin:             "Admin",
+	Mod:               "Mod",
+	Elite:             "Elite",
+	User:              "User",
+	Muted:             "Muted",
+	Banned:            "Banned",
+	NeedsConfirmation: "Needs Confirmation",
+}
+
+// String returns the name of the role.
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "Unknown"
+}
@@ -1,37 +1,72 @@
 package database
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"math/rand"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/DarthHater/bored-board-service/constants"
 	"github.com/DarthHater/bored-board-service/model"
 	"github.com/DavidHuie/gomigrate"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
 )
 
 type IDatabase interface {
 	InitDb(s string, e string) error
 	EditUser(u *model.User) error
-	CreateUser(u *model.User) (string, int, error)
-	ConfirmUser(s string, i int) (bool, error)
+	CreateUser(u *model.User) (string, string, error)
+	ConfirmUser(s string, c string) (bool, error)
+	RenewConfirmCode(s string, throttle time.Duration) (string, error)
 	GetUser(s string) (model.User, error)
+	GetUserByID(s string) (model.User, error)
+	GetUserByEmail(s string) (model.User, error)
+	CreatePasswordReset(userID string, tokenHash string, lifetime time.Duration, throttle time.Duration) error
+	ResetPassword(tokenHash string, password []byte) (string, error)
+	CreateRefreshToken(userID string, tokenHash string, lifetime time.Duration) error
+	RotateRefreshToken(oldHash string, newHash string, lifetime time.Duration) (string, error)
+	RevokeRefreshToken(userID string, tokenHash string) error
+	RevokeUserRefreshTokens(userID string) error
+	EnqueueEmail(e *model.OutboxEmail) (string, error)
+	ClaimOutboxEmails(limit int, lease time.Duration) ([]model.OutboxEmail, error)
+	MarkEmailSent(s string) error
+	MarkEmailFailed(s string, reason string, retryIn time.Duration, dead bool) error
+	GetOutboxEmails(status string, limit int) ([]model.OutboxEmail, error)
+	RetryEmail(s string) error
+	AppendEvent(e *model.Event) error
+	GetEventsSince(seq int64, topics []string, limit int) ([]model.Event, error)
+	CreateNotification(n *model.Notification) error
+	GetNotifications(userID string, unreadOnly bool, limit int) ([]model.Notification, error)
+	CountUnreadNotifications(userID string) (int, error)
+	MarkNotificationRead(userID string, notificationID string) error
+	MarkAllNotificationsRead(userID string) error
 	GetUsers(s string) ([]model.User, error)
 	GetThread(s string) (model.Thread, error)
+	GetThreadSummary(s string) (model.ThreadSummary, error)
 	GetMessage(s string) (model.Message, error)
 	GetMessages(i int, u string) ([]model.Message, error)
 	GetMessagePosts(s string) ([]model.MessagePost, error)
+	IsMessageMember(messageID string, userID string) (bool, error)
+	GetMessageMemberIDs(s string) ([]string, error)
 	GetPost(s string) (model.Post, error)
-	GetPosts(s string) ([]model.Post, error)
-	GetThreads(i int, since string) ([]model.Thread, error)
+	GetPosts(s string, p model.PostPageRequest) (model.PostPage, error)
+	GetThreads(i int, since string, r constants.Role) ([]model.Thread, error)
+	GetCategories(r constants.Role) ([]model.Category, error)
+	GetCategory(s string) (model.Category, error)
+	GetCategoryThreads(s string, i int, since string) ([]model.Thread, error)
+	PostCategory(c *model.Category) (model.Category, error)
+	ReorderCategories(ids []string) error
+	ArchiveCategory(s string) error
 	GetUserInfo(userID string) (model.UserInfo, error)
 	HandlePasswordMigration(u *model.User, c *model.Credentials) error
 	PostThread(t *model.NewThread) (model.NewThread, error)
@@ -40,11 +75,49 @@ type IDatabase interface {
 	PostMessagePost(p *model.MessagePost) (model.MessagePost, error)
 	DeleteThread(s string) error
 	EditPost(i string, b string) (model.Post, error)
+	SavePostMentions(postID string, m []model.Mention) ([]model.Mention, []string, error)
+	GetPostMentions(postIDs []string) (map[string][]model.Mention, error)
+	DeletePost(s string) error
+	RestorePost(s string) error
+	RestoreThread(s string) error
+	AppendModLog(e *model.ModLogEntry) error
+	CreateSanction(s *model.Sanction, duration time.Duration) error
+	GetActiveSanctions(userID string) ([]model.Sanction, error)
+	GetSanctions(userID string) ([]model.Sanction, error)
+	GetSanction(sanctionID string) (model.Sanction, error)
+	LiftSanction(sanctionID string, liftedBy string) (model.Sanction, error)
+	ExpireSanctions() ([]model.Sanction, error)
+	HasPermission(r constants.Role, p constants.Permission, categoryID string) (bool, error)
+	GetRolePermissions() ([]model.RolePermissions, error)
+	SetRolePermissions(r constants.Role, permissions []string) error
+	GetCategoryPermissions(categoryID string) ([]model.CategoryPermission, error)
+	SetCategoryPermissions(categoryID string, overrides []model.CategoryPermission) error
+	GetThreadCategoryID(threadID string) (string, error)
+	GetPostCategoryID(postID string) (string, error)
+	GetModLog(f model.ModLogFilter) ([]model.ModLogEntry, error)
+	SetUserRole(userID string, r constants.Role) error
+	CreateReport(r *model.Report) error
+	GetReport(s string) (model.Report, error)
+	GetReportQueue(status string, reason string, limit int) ([]model.ReportedPost, error)
+	ResolveReports(postID string, modID string, status constants.ReportStatus, resolution string) error
 }
 
 type Database struct {
 }
 
+// confirmCodeLifetime is how long a new user has to confirm their account using the code we email them.
+const confirmCodeLifetime = 48 * time.Hour
+
+// eventLogSize is roughly how many events are kept for clients to replay when they reconnect.
+const eventLogSize = 10000
+
+// eventLogPruneInterval is how many events are logged between pruning old ones.
+const eventLogPruneInterval = 100
+
+// eventLogPrunedAt is the sequence number this server last pruned the event log at. Sequence numbers can
+// skip values, so pruning happens whenever an event crosses the next interval rather than lands on it.
+var eventLogPrunedAt int64
+
 var DB *sql.DB
 
 // Public methods
@@ -74,18 +147,53 @@ func (d *Database) InitDb(environment string, configPath string) error {
 // GetThread will get a thread with the given ID.
 func (d *Database) GetThread(threadID string) (model.Thread, error) {
 	thread := model.Thread{}
-	err := DB.QueryRow(`SELECT bt.Id, bt.UserId, bt.Title, bt.PostedAt, bu.Username
+	err := DB.QueryRow(`SELECT bt.Id, bt.UserId, bt.Title, bt.PostedAt, bu.Username, bt.CategoryId
 			FROM board.thread bt
 			INNER JOIN board.user bu ON bt.UserId = bu.Id
 			WHERE bt.Id = $1 AND bt.Deleted != true
 			ORDER BY PostedAt DESC limit 20`, threadID).
-		Scan(&thread.Id, &thread.UserId, &thread.Title, &thread.PostedAt, &thread.UserName)
+		Scan(&thread.Id, &thread.UserId, &thread.Title, &thread.PostedAt, &thread.UserName, &thread.CategoryId)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return thread, ErrNoThread
+		}
 		return thread, err
 	}
 	return thread, nil
 }
 
+// GetThreadSummary gets a thread along with its reply count and who posted in it last. A thread whose posts
+// have all been deleted has no replies and no last poster.
+func (d *Database) GetThreadSummary(threadID string) (model.ThreadSummary, error) {
+	summary := model.ThreadSummary{}
+	err := DB.QueryRow(`SELECT bt.Id, bt.Title, bt.UserId, bu.Username, bt.CategoryId, bc.RequiredRole,
+			bt.PostedAt, bt.LastPostedAt,
+			GREATEST((SELECT count(*) FROM board.thread_post WHERE ThreadId = bt.Id AND Deleted != true) - 1, 0),
+			COALESCE(lp.UserId::text, ''), COALESCE(lp.Username, '')
+			FROM board.thread bt
+			INNER JOIN board.user bu ON bt.UserId = bu.Id
+			INNER JOIN board.category bc ON bt.CategoryId = bc.Id
+			LEFT JOIN LATERAL (
+				SELECT tp.UserId, pu.Username
+				FROM board.thread_post tp
+				INNER JOIN board.user pu ON tp.UserId = pu.Id
+				WHERE tp.ThreadId = bt.Id AND tp.Deleted != true
+				ORDER BY tp.PostedAt DESC, tp.Id DESC
+				LIMIT 1
+			) lp ON true
+			WHERE bt.Id = $1 AND bt.Deleted != true`, threadID).
+		Scan(&summary.Id, &summary.Title, &summary.UserId, &summary.UserName, &summary.CategoryId,
+			&summary.RequiredRole, &summary.PostedAt, &summary.LastPostedAt, &summary.ReplyCount,
+			&summary.LastPosterId, &summary.LastPosterName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return summary, ErrNoThread
+		}
+		return summary, err
+	}
+	return summary, nil
+}
+
 // GetMessage will get a message with the given ID.
 func (d *Database) GetMessage(messageID string) (model.Message, error) {
 	message := model.Message{}
@@ -128,9 +236,12 @@ func (d *Database) GetPost(postID string) (post model.Post, err error) {
 	err = DB.QueryRow(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
 		FROM board.thread_post tp
 		INNER JOIN board.user bu ON tp.UserId = bu.Id
-		WHERE Id = $1 AND Deleted != true`, postID).
+		WHERE tp.Id = $1 AND tp.Deleted != true`, postID).
 		Scan(&post.Id, &post.ThreadId, &post.UserId, &post.Body, &post.PostedAt, &post.UserName)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return post, ErrNoPost
+		}
 		return post, err
 	}
 	return post, nil
@@ -149,6 +260,30 @@ func (d *Database) GetUser(username string) (user model.User, err error) {
 	return user, nil
 }
 
+// GetUserByID retrieves a given user by their ID.
+func (d *Database) GetUserByID(userID string) (user model.User, err error) {
+	user = model.User{}
+	err = DB.QueryRow("SELECT Id, Username, EmailAddress, UserPassword, UserRole, UserPasswordMD5 FROM board.user WHERE Id = $1", userID).
+		Scan(&user.ID, &user.Username, &user.EmailAddress, &user.Password, &user.UserRole, &user.UserPasswordMd5)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves a given user by their email address.
+func (d *Database) GetUserByEmail(emailAddress string) (user model.User, err error) {
+	user = model.User{}
+	err = DB.QueryRow("SELECT Id, Username, EmailAddress, UserPassword, UserRole, UserPasswordMD5 FROM board.user WHERE lower(EmailAddress) = lower($1)", emailAddress).
+		Scan(&user.ID, &user.Username, &user.EmailAddress, &user.Password, &user.UserRole, &user.UserPasswordMd5)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
 // GetUsers will return a list of users whose username matches a search string.
 func (d *Database) GetUsers(search string) ([]model.User, error) {
 	users := []model.User{}
@@ -200,12 +335,9 @@ func (d *Database) GetUserInfo(userID string) (userInfo model.UserInfo, err erro
 	return userInfo, nil
 }
 
-// GetThreads retrieves a given number of threads.
-func (d *Database) GetThreads(num int, since string) ([]model.Thread, error) {
-	var threads []model.Thread
-	i, _ := strconv.ParseInt(since, 10, 64)
-
-	t := time.Unix(0, i*int64(time.Millisecond))
+// GetThreads retrieves a given number of threads from every category the given role can see.
+func (d *Database) GetThreads(num int, since string, role constants.Role) ([]model.Thread, error) {
+	t := sinceTime(since)
 
 	log.WithFields(log.Fields{
 		"convertedTime": t,
@@ -213,69 +345,184 @@ func (d *Database) GetThreads(num int, since string) ([]model.Thread, error) {
 		"number":        num,
 	}).Debug("Attempting To Get Thread List")
 
-	rows, err := DB.Query(`SELECT bt.Id, bt.UserId, bt.Title, bt.PostedAt, bu.Username, bt.LastPostedAt
+	rows, err := DB.Query(`SELECT bt.Id, bt.UserId, bt.Title, bt.PostedAt, bu.Username, bt.LastPostedAt, bt.CategoryId
 		FROM board.thread bt
 		INNER JOIN board.user bu ON bt.UserId = bu.Id
+		INNER JOIN board.category bc ON bt.CategoryId = bc.Id
 		WHERE bt.Deleted != true AND bt.LastPostedAt < $1
-		ORDER BY bt.LastPostedAt DESC LIMIT $2`, t, num)
+			AND bc.Archived != true AND bc.RequiredRole >= $2
+		ORDER BY bt.LastPostedAt DESC LIMIT $3`, t, role.AccessLevel(), num)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanThreads(rows)
+}
+
+// GetCategoryThreads retrieves a given number of threads within a category.
+func (d *Database) GetCategoryThreads(categoryID string, num int, since string) ([]model.Thread, error) {
+	t := sinceTime(since)
+
+	rows, err := DB.Query(`SELECT bt.Id, bt.UserId, bt.Title, bt.PostedAt, bu.Username, bt.LastPostedAt, bt.CategoryId
+		FROM board.thread bt
+		INNER JOIN board.user bu ON bt.UserId = bu.Id
+		WHERE bt.Deleted != true AND bt.CategoryId = $1 AND bt.LastPostedAt < $2
+		ORDER BY bt.LastPostedAt DESC LIMIT $3`, categoryID, t, num)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanThreads(rows)
+}
 
+// GetCategories will return every category that isn't archived and that the given role can see.
+func (d *Database) GetCategories(role constants.Role) ([]model.Category, error) {
+	categories := []model.Category{}
+	rows, err := DB.Query(`SELECT Id, Title, Description, SortOrder, RequiredRole, IsDefault, Archived
+		FROM board.category
+		WHERE Archived != true AND RequiredRole >= $1
+		ORDER BY SortOrder, Title`, role.AccessLevel())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		t := model.Thread{}
-		if err := rows.Scan(&t.Id, &t.UserId, &t.Title, &t.PostedAt, &t.UserName, &t.LastPostedAt); err != nil {
+		c := model.Category{}
+		if err := rows.Scan(&c.Id, &c.Title, &c.Description, &c.SortOrder, &c.RequiredRole, &c.IsDefault, &c.Archived); err != nil {
 			return nil, err
 		}
-		threads = append(threads, t)
+		categories = append(categories, c)
 	}
 	if rows.Err() != nil {
-		panic(rows.Err())
+		return nil, rows.Err()
 	}
 
-	return threads, nil
+	return categories, nil
 }
 
-// GetPosts will return all posts under a given thread.
-func (d *Database) GetPosts(threadId string) ([]model.Post, error) {
-	var posts []model.Post
-	rows, err := DB.Query(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
-			FROM board.thread_post tp
-			INNER JOIN board.user bu ON tp.UserId = bu.Id
-			WHERE ThreadId = $1
-			ORDER BY tp.PostedAt`, threadId)
+// GetCategory retrieves a single category. An empty ID returns the default category.
+func (d *Database) GetCategory(categoryID string) (category model.Category, err error) {
+	var row *sql.Row
+	if categoryID == "" {
+		row = DB.QueryRow(`SELECT Id, Title, Description, SortOrder, RequiredRole, IsDefault, Archived
+			FROM board.category
+			WHERE IsDefault = true`)
+	} else {
+		row = DB.QueryRow(`SELECT Id, Title, Description, SortOrder, RequiredRole, IsDefault, Archived
+			FROM board.category
+			WHERE Id = $1`, categoryID)
+	}
+
+	err = row.Scan(&category.Id, &category.Title, &category.Description, &category.SortOrder,
+		&category.RequiredRole, &category.IsDefault, &category.Archived)
 	if err != nil {
-		return nil, err
+		if err == sql.ErrNoRows {
+			return category, ErrNoCategory
+		}
+		return category, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		p := model.Post{}
-		if err := rows.Scan(&p.Id, &p.ThreadId, &p.UserId, &p.Body, &p.PostedAt, &p.UserName); err != nil {
-			return nil, err
+	return category, nil
+}
+
+// PostCategory creates a new category at the end of the category list.
+func (d *Database) PostCategory(category *model.Category) (newCategory model.Category, err error) {
+	sqlStatement := `
+		INSERT INTO board.category
+		(Title, Description, RequiredRole, SortOrder)
+		VALUES ($1, $2, $3, (SELECT COALESCE(MAX(SortOrder) + 1, 0) FROM board.category))
+		RETURNING Id, Title, Description, SortOrder, RequiredRole, IsDefault, Archived`
+	err = DB.QueryRow(sqlStatement,
+		category.Title,
+		category.Description,
+		category.RequiredRole).
+		Scan(&newCategory.Id, &newCategory.Title, &newCategory.Description, &newCategory.SortOrder,
+			&newCategory.RequiredRole, &newCategory.IsDefault, &newCategory.Archived)
+	if err != nil {
+		return newCategory, err
+	}
+
+	return newCategory, nil
+}
+
+// ReorderCategories sets the order of categories to match the order of the given IDs.
+func (d *Database) ReorderCategories(categoryIDs []string) (err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range categoryIDs {
+		res, err := tx.Exec(`
+			UPDATE board.category
+			SET SortOrder = $1
+			WHERE Id = $2`, i, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if count, _ := res.RowsAffected(); count == 0 {
+			tx.Rollback()
+			return ErrNoCategory
 		}
-		posts = append(posts, p)
 	}
-	if rows.Err() != nil {
-		panic(rows.Err())
+
+	return tx.Commit()
+}
+
+// ArchiveCategory hides a category and its threads from listings and stops new threads being posted to it.
+// The default category can't be archived.
+func (d *Database) ArchiveCategory(categoryID string) (err error) {
+	sqlStatement := `
+		UPDATE board.category
+		SET Archived = true
+		WHERE Id = $1 AND IsDefault != true`
+
+	res, err := DB.Exec(sqlStatement, categoryID)
+	if err != nil {
+		return err
 	}
 
-	return posts, nil
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoCategory
+	}
+
+	return nil
+}
+
+// GetPosts will return a page of posts under a given thread, ordered by when they were posted.
+func (d *Database) GetPosts(threadID string, page model.PostPageRequest) (model.PostPage, error) {
+	switch {
+	case page.Around != "":
+		return d.getPostsAround(threadID, page.Around, page.Limit)
+	case page.Before != "":
+		return d.getPostsBefore(threadID, page.Before, page.Limit)
+	default:
+		return d.getPostsAfter(threadID, page.After, page.Limit)
+	}
 }
 
 // PostThread creates a new thread.
 func (d *Database) PostThread(newThread *model.NewThread) (thread model.NewThread, err error) {
 	sqlStatement := `
 		INSERT INTO board.thread
-		(UserId, Title)
-		VALUES ($1, $2)
-		RETURNING Id, UserId, Title, PostedAt, (SELECT Username FROM board.user WHERE Id = $1)`
+		(UserId, Title, CategoryId)
+		VALUES ($1, $2, $3)
+		RETURNING Id, UserId, Title, PostedAt, (SELECT Username FROM board.user WHERE Id = $1), CategoryId`
 	err = DB.QueryRow(sqlStatement,
 		newThread.T.UserId,
-		newThread.T.Title).
-		Scan(&thread.T.Id, &thread.T.UserId, &thread.T.Title, &thread.T.PostedAt, &thread.T.UserName)
+		newThread.T.Title,
+		newThread.T.CategoryId).
+		Scan(&thread.T.Id, &thread.T.UserId, &thread.T.Title, &thread.T.PostedAt, &thread.T.UserName, &thread.T.CategoryId)
 	if err != nil {
 		return thread, err
 	}
@@ -374,6 +621,64 @@ func (d *Database) DeleteThread(threadID string) (err error) {
 	return
 }
 
+// DeletePost will do a soft delete on a single post.
+func (d *Database) DeletePost(postID string) (err error) {
+	res, err := DB.Exec(`UPDATE board.thread_post SET Deleted = true WHERE Id = $1`, postID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoPost
+	}
+
+	return nil
+}
+
+// RestorePost undoes the soft delete of a single post.
+func (d *Database) RestorePost(postID string) (err error) {
+	res, err := DB.Exec(`UPDATE board.thread_post SET Deleted = false WHERE Id = $1 AND Deleted = true`, postID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoPost
+	}
+
+	return nil
+}
+
+// RestoreThread undoes the soft delete of a thread and its posts.
+func (d *Database) RestoreThread(threadID string) (err error) {
+	res, err := DB.Exec(`UPDATE board.thread SET Deleted = false WHERE Id = $1 AND Deleted = true`, threadID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoThread
+	}
+
+	_, err = DB.Exec(`UPDATE board.thread_post SET Deleted = false WHERE ThreadId = $1`, threadID)
+	return err
+}
+
 // EditPost allows a user to edit a post within 10 minutes of posting it.
 func (d *Database) EditPost(id string, body string) (post model.Post, err error) {
 	sqlStatement := `
@@ -395,6 +700,118 @@ func (d *Database) EditPost(id string, body string) (post model.Post, err error)
 	return post, nil
 }
 
+// SavePostMentions matches the usernames in a post's mentions to users, ignoring case, and replaces the
+// mentions stored for the post with the ones that matched. It returns those mentions along with the IDs
+// of users who weren't mentioned in the post before, so edits don't mention the same user twice.
+func (d *Database) SavePostMentions(postID string, mentions []model.Mention) ([]model.Mention, []string, error) {
+	users := make(map[string]model.Mention)
+	if len(mentions) > 0 {
+		names := make([]string, 0, len(mentions))
+		for _, m := range mentions {
+			names = append(names, strings.ToLower(m.UserName))
+		}
+
+		rows, err := DB.Query(`SELECT Id, Username FROM board.user
+			WHERE lower(Username) = ANY($1)`, pq.Array(names))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			u := model.Mention{}
+			if err := rows.Scan(&u.UserId, &u.UserName); err != nil {
+				return nil, nil, err
+			}
+			users[strings.ToLower(u.UserName)] = u
+		}
+		if rows.Err() != nil {
+			return nil, nil, rows.Err()
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.Query(`DELETE FROM board.post_mention WHERE PostId = $1 RETURNING UserId`, postID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	previous := make(map[string]bool)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, nil, err
+		}
+		previous[userID] = true
+	}
+	rows.Close()
+
+	saved := []model.Mention{}
+	var added []string
+	for _, m := range mentions {
+		u, ok := users[strings.ToLower(m.UserName)]
+		if !ok {
+			continue
+		}
+		m.UserId, m.UserName = u.UserId, u.UserName
+
+		_, err = tx.Exec(`
+			INSERT INTO board.post_mention
+			(PostId, UserId, StartOffset, EndOffset)
+			VALUES ($1, $2, $3, $4)`, postID, m.UserId, m.Start, m.End)
+		if err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		saved = append(saved, m)
+
+		if !previous[m.UserId] {
+			previous[m.UserId] = true
+			added = append(added, m.UserId)
+		}
+	}
+
+	return saved, added, tx.Commit()
+}
+
+// GetPostMentions returns the mentions in each of the given posts, keyed by post ID.
+func (d *Database) GetPostMentions(postIDs []string) (map[string][]model.Mention, error) {
+	mentions := make(map[string][]model.Mention)
+	if len(postIDs) == 0 {
+		return mentions, nil
+	}
+
+	rows, err := DB.Query(`SELECT pm.PostId, pm.UserId, bu.Username, pm.StartOffset, pm.EndOffset
+		FROM board.post_mention pm
+		INNER JOIN board.user bu ON pm.UserId = bu.Id
+		WHERE pm.PostId = ANY($1::uuid[])
+		ORDER BY pm.PostId, pm.StartOffset`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID string
+		m := model.Mention{}
+		if err := rows.Scan(&postID, &m.UserId, &m.UserName, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		mentions[postID] = append(mentions[postID], m)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return mentions, nil
+}
+
 // GetMessages retrieves a given number of messages.
 func (d *Database) GetMessages(num int, userid string) ([]model.Message, error) {
 	var messages []model.Message
@@ -448,6 +865,43 @@ func (d *Database) GetMessagePosts(messageID string) ([]model.MessagePost, error
 	return messageposts, nil
 }
 
+// IsMessageMember checks whether a user is a member of a message, and so is allowed to read and reply to it.
+func (d *Database) IsMessageMember(messageID string, userID string) (member bool, err error) {
+	err = DB.QueryRow(`SELECT EXISTS (
+			SELECT 1 FROM board.message_member
+			WHERE MessageId = $1 AND UserId = $2 AND Deleted != true)`, messageID, userID).
+		Scan(&member)
+	if err != nil {
+		return false, err
+	}
+
+	return member, nil
+}
+
+// GetMessageMemberIDs returns the IDs of everyone in a message.
+func (d *Database) GetMessageMemberIDs(messageID string) ([]string, error) {
+	rows, err := DB.Query(`SELECT UserId FROM board.message_member
+		WHERE MessageId = $1 AND Deleted != true`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return userIDs, nil
+}
+
 // PostMessage will create a new message "thread".
 func (d *Database) PostMessage(newMessage *model.NewMessage) (message model.NewMessage, err error) {
 	sqlStatement := `
@@ -513,35 +967,41 @@ func (d *Database) PostMessagePost(message *model.MessagePost) (newMessage model
 	return newMessage, nil
 }
 
-// CreateUser creates a new user.
-func (d *Database) CreateUser(user *model.User) (userid string, confirm int, err error) {
+// CreateUser creates a new user along with a code, valid for confirmCodeLifetime, to confirm their account.
+func (d *Database) CreateUser(user *model.User) (userid string, confirm string, err error) {
 	var id string
-	confirmCode := rand.Int()
+	confirmCode, err := newConfirmCode()
+	if err != nil {
+		return "", "", err
+	}
+
 	sqlStatement := `
 		INSERT INTO board.user
-		(Username, EmailAddress, UserPassword, UserRole, ConfirmCode)
-		VALUES ($1, $2, $3, $4, $5)
+		(Username, EmailAddress, UserPassword, UserRole, ConfirmCode, ConfirmCodeExpiresAt, ConfirmSentAt)
+		VALUES ($1, $2, $3, $4, $5, now() + ($6 * interval '1 second'), now())
 		RETURNING Id`
 	err = DB.QueryRow(sqlStatement,
 		user.Username,
 		user.EmailAddress,
 		user.Password,
 		constants.NeedsConfirmation,
-		confirmCode).Scan(&id)
+		confirmCode,
+		int(confirmCodeLifetime.Seconds())).Scan(&id)
 	if err != nil {
-		return "", 0, err
+		return "", "", err
 	}
 
 	return id, confirmCode, nil
 }
 
-// ConfirmUser sets a user to active in the database
-func (d *Database) ConfirmUser(userID string, confirmCode int) (confirmed bool, err error) {
+// ConfirmUser sets a user to active in the database. If the code matches but has expired,
+// ErrConfirmCodeExpired is returned.
+func (d *Database) ConfirmUser(userID string, confirmCode string) (confirmed bool, err error) {
 	sqlStatement := `
 		UPDATE board.user
-		SET UserRole = 3, ConfirmCode = NULL
-		WHERE ID = $1 AND ConfirmCode = $2 AND UserRole = 6`
-	res, err := DB.Exec(sqlStatement, userID, confirmCode)
+		SET UserRole = $1, ConfirmCode = NULL, ConfirmCodeExpiresAt = NULL
+		WHERE ID = $2 AND ConfirmCode = $3 AND UserRole = $4 AND ConfirmCodeExpiresAt > now()`
+	res, err := DB.Exec(sqlStatement, constants.User, userID, confirmCode, constants.NeedsConfirmation)
 	if err != nil {
 		return false, err
 	}
@@ -550,9 +1010,58 @@ func (d *Database) ConfirmUser(userID string, confirmCode int) (confirmed bool,
 
 	if rows > 0 {
 		return true, nil
-	} else {
-		return false, nil
 	}
+
+	var expired bool
+	err = DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM board.user
+			WHERE ID = $1 AND ConfirmCode = $2 AND UserRole = $3)`, userID, confirmCode, constants.NeedsConfirmation).
+		Scan(&expired)
+	if err != nil {
+		return false, err
+	}
+
+	if expired {
+		return false, ErrConfirmCodeExpired
+	}
+
+	return false, nil
+}
+
+// RenewConfirmCode replaces an unconfirmed user's confirmation code with a new one. Returns
+// ErrConfirmThrottled if the last code was sent less than throttle ago.
+func (d *Database) RenewConfirmCode(userID string, throttle time.Duration) (confirm string, err error) {
+	confirmCode, err := newConfirmCode()
+	if err != nil {
+		return "", err
+	}
+
+	sqlStatement := `
+		UPDATE board.user
+		SET ConfirmCode = $1, ConfirmCodeExpiresAt = now() + ($2 * interval '1 second'), ConfirmSentAt = now()
+		WHERE Id = $3 AND UserRole = $4
+			AND (ConfirmSentAt IS NULL OR ConfirmSentAt < now() - ($5 * interval '1 second'))`
+	res, err := DB.Exec(sqlStatement,
+		confirmCode,
+		int(confirmCodeLifetime.Seconds()),
+		userID,
+		constants.NeedsConfirmation,
+		int(throttle.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if count == 0 {
+		return "", ErrConfirmThrottled
+	}
+
+	return confirmCode, nil
 }
 
 // EditUser updates an existing user.
@@ -574,8 +1083,921 @@ func (d *Database) EditUser(user *model.User) (err error) {
 	return nil
 }
 
-// HandlePasswordMigration will check a user's password against their hashed MD5 password from the legacy site. If
-// it's a match, it will encrypt their password with bcrypt and delete the hashed password.
+// CreatePasswordReset stores the hash of a password reset token for a user, which can be used for lifetime.
+// Expiry times are worked out by the database, so they compare correctly with its now(). Returns
+// ErrPasswordResetThrottled if the user's last reset was created less than throttle ago.
+func (d *Database) CreatePasswordReset(userID string, tokenHash string, lifetime time.Duration, throttle time.Duration) (err error) {
+	sqlStatement := `
+		INSERT INTO board.password_reset
+		(UserId, TokenHash, ExpiresAt)
+		SELECT $1, $2, now() + ($3 * interval '1 second')
+		WHERE NOT EXISTS (
+			SELECT 1 FROM board.password_reset
+			WHERE UserId = $1 AND CreatedAt > now() - ($4 * interval '1 second'))`
+
+	res, err := DB.Exec(sqlStatement, userID, tokenHash, int(lifetime.Seconds()), int(throttle.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrPasswordResetThrottled
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password for the user a valid reset token belongs to, and marks every
+// outstanding reset token for that user as used.
+func (d *Database) ResetPassword(tokenHash string, password []byte) (userID string, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.QueryRow(`
+		SELECT UserId
+		FROM board.password_reset
+		WHERE TokenHash = $1 AND UsedAt IS NULL AND ExpiresAt > now()
+		FOR UPDATE`, tokenHash).Scan(&userID)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidResetToken
+		}
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE board.user
+		SET UserPassword = $1, UserPasswordMd5 = NULL
+		WHERE Id = $2`, password, userID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE board.password_reset
+		SET UsedAt = now()
+		WHERE UserId = $1 AND UsedAt IS NULL`, userID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
+
+// CreateRefreshToken stores the hash of a refresh token for a user, which can be used for lifetime.
+func (d *Database) CreateRefreshToken(userID string, tokenHash string, lifetime time.Duration) (err error) {
+	sqlStatement := `
+		INSERT INTO board.refresh_token
+		(UserId, TokenHash, ExpiresAt)
+		VALUES ($1, $2, now() + ($3 * interval '1 second'))`
+
+	_, err = DB.Exec(sqlStatement, userID, tokenHash, int(lifetime.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RotateRefreshToken revokes a refresh token and stores a new one for the same user in its place.
+// Using a token that was already rotated or revoked means it has probably been stolen, so every refresh
+// token the user has is revoked and ErrRefreshTokenReused is returned along with the user's id.
+func (d *Database) RotateRefreshToken(oldHash string, newHash string, lifetime time.Duration) (userID string, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var revoked, expired bool
+	err = tx.QueryRow(`
+		SELECT UserId, RevokedAt IS NOT NULL, ExpiresAt <= now()
+		FROM board.refresh_token
+		WHERE TokenHash = $1
+		FOR UPDATE`, oldHash).Scan(&userID, &revoked, &expired)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidRefreshToken
+		}
+		return "", err
+	}
+
+	if revoked {
+		_, err = tx.Exec(`
+			UPDATE board.refresh_token
+			SET RevokedAt = now()
+			WHERE UserId = $1 AND RevokedAt IS NULL`, userID)
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return "", err
+		}
+		return userID, ErrRefreshTokenReused
+	}
+
+	if expired {
+		tx.Rollback()
+		return "", ErrInvalidRefreshToken
+	}
+
+	_, err = tx.Exec(`
+		UPDATE board.refresh_token
+		SET RevokedAt = now()
+		WHERE TokenHash = $1`, oldHash)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO board.refresh_token
+		(UserId, TokenHash, ExpiresAt)
+		VALUES ($1, $2, now() + ($3 * interval '1 second'))`, userID, newHash, int(lifetime.Seconds()))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
+
+// RevokeRefreshToken revokes a single refresh token belonging to a user.
+func (d *Database) RevokeRefreshToken(userID string, tokenHash string) (err error) {
+	sqlStatement := `
+		UPDATE board.refresh_token
+		SET RevokedAt = now()
+		WHERE UserId = $1 AND TokenHash = $2 AND RevokedAt IS NULL`
+
+	_, err = DB.Exec(sqlStatement, userID, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token a user has.
+func (d *Database) RevokeUserRefreshTokens(userID string) (err error) {
+	sqlStatement := `
+		UPDATE board.refresh_token
+		SET RevokedAt = now()
+		WHERE UserId = $1 AND RevokedAt IS NULL`
+
+	_, err = DB.Exec(sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EnqueueEmail adds an email to the outbox to be sent by the outbox worker.
+func (d *Database) EnqueueEmail(email *model.OutboxEmail) (id string, err error) {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return "", err
+	}
+
+	sqlStatement := `
+		INSERT INTO board.email_outbox
+		(Template, Recipient, RecipientName, Subject, Data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING Id`
+	err = DB.QueryRow(sqlStatement,
+		email.Template,
+		email.Recipient,
+		email.RecipientName,
+		email.Subject,
+		data).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// ClaimOutboxEmails returns pending emails that are due to be sent and counts an attempt against each.
+// Claimed emails won't be returned again until the lease has passed, so that if the worker dies while
+// sending them another worker can pick them up.
+func (d *Database) ClaimOutboxEmails(limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	rows, err := DB.Query(`
+		UPDATE board.email_outbox
+		SET Attempts = Attempts + 1, NextAttemptAt = now() + ($2 * interval '1 second')
+		WHERE Id IN (
+			SELECT Id FROM board.email_outbox
+			WHERE Status = $3 AND NextAttemptAt <= now()
+			ORDER BY NextAttemptAt
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING `+outboxEmailColumns, limit, int(lease.Seconds()), constants.EmailPending)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+// MarkEmailSent records that an email was delivered. Its template data is cleared, since it holds links
+// and codes that would let anyone who can read the outbox take over the recipient's account.
+func (d *Database) MarkEmailSent(emailID string) (err error) {
+	sqlStatement := `
+		UPDATE board.email_outbox
+		SET Status = $1, SentAt = now(), LastError = '', Data = '{}'
+		WHERE Id = $2`
+
+	_, err = DB.Exec(sqlStatement, constants.EmailSent, emailID)
+	return err
+}
+
+// MarkEmailFailed records why an email couldn't be sent, and either schedules the next attempt or marks
+// it as dead so it's no longer retried. Dead emails have their template data cleared, the same as sent ones.
+func (d *Database) MarkEmailFailed(emailID string, reason string, retryIn time.Duration, dead bool) (err error) {
+	status := constants.EmailPending
+	if dead {
+		status = constants.EmailDead
+	}
+
+	sqlStatement := `
+		UPDATE board.email_outbox
+		SET Status = $1, LastError = $2, NextAttemptAt = now() + ($3 * interval '1 second'),
+			Data = CASE WHEN $5 THEN '{}' ELSE Data END
+		WHERE Id = $4`
+
+	_, err = DB.Exec(sqlStatement, status, reason, int(retryIn.Seconds()), emailID, dead)
+	return err
+}
+
+// GetOutboxEmails lists the most recent emails with the given status, or every status if it's empty.
+func (d *Database) GetOutboxEmails(status string, limit int) ([]model.OutboxEmail, error) {
+	rows, err := DB.Query(`
+		SELECT `+outboxEmailColumns+`
+		FROM board.email_outbox
+		WHERE $1 = '' OR Status = $1
+		ORDER BY CreatedAt DESC
+		LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+// RetryEmail puts a dead email back in the queue with a fresh set of attempts. Emails whose template data
+// was cleared when they died can't be retried, the user has to ask for a new one.
+func (d *Database) RetryEmail(emailID string) (err error) {
+	sqlStatement := `
+		UPDATE board.email_outbox
+		SET Status = $1, Attempts = 0, NextAttemptAt = now()
+		WHERE Id = $2 AND Status = $3 AND Data != '{}'`
+
+	res, err := DB.Exec(sqlStatement, constants.EmailPending, emailID, constants.EmailDead)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoEmail
+	}
+
+	return nil
+}
+
+// SetUserRole changes a user's role. The last admin can't be given another role, so there's always
+// someone who can manage the board. Every admin is locked while the change is made, so two admins can't
+// demote each other at the same time.
+func (d *Database) SetUserRole(userID string, role constants.Role) (err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT Id FROM board.user WHERE UserRole = $1 FOR UPDATE`, constants.Admin)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	admins := 0
+	for rows.Next() {
+		admins++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var current constants.Role
+	err = tx.QueryRow(`SELECT UserRole FROM board.user WHERE Id = $1 FOR UPDATE`, userID).Scan(&current)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNoUser
+		}
+		return err
+	}
+
+	if current == constants.Admin && role != constants.Admin && admins <= 1 {
+		tx.Rollback()
+		return ErrLastAdmin
+	}
+
+	if _, err = tx.Exec(`UPDATE board.user SET UserRole = $1 WHERE Id = $2`, role, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateReport saves a report about a post, setting its ID, status and when it was made. A user can only
+// have one open report about a post at a time.
+func (d *Database) CreateReport(r *model.Report) (err error) {
+	sqlStatement := `
+		INSERT INTO board.report
+		(PostId, ReporterId, Reason, Details)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (PostId, ReporterId) WHERE Status = 'open' DO NOTHING
+		RETURNING Id, Status, CreatedAt`
+
+	err = DB.QueryRow(sqlStatement, r.PostId, r.ReporterId, r.Reason, r.Details).
+		Scan(&r.Id, &r.Status, &r.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyReported
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetReport gets a report with the given ID.
+func (d *Database) GetReport(reportID string) (model.Report, error) {
+	r := model.Report{}
+	err := DB.QueryRow(`SELECT `+reportColumns+`
+		FROM board.report br
+		INNER JOIN board.user ru ON br.ReporterId = ru.Id
+		LEFT JOIN board.user mu ON br.ResolvedBy = mu.Id
+		WHERE br.Id = $1`, reportID).
+		Scan(&r.Id, &r.PostId, &r.ReporterId, &r.ReporterName, &r.Reason, &r.Details, &r.Status, &r.CreatedAt,
+			&r.ResolvedBy, &r.ResolvedByName, &r.ResolvedAt, &r.Resolution)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return r, ErrNoReport
+		}
+		return r, err
+	}
+
+	return r, nil
+}
+
+// GetReportQueue returns reported posts along with their reports, most recently reported first. Status
+// and reason filter the reports when they aren't empty, and limit is the most posts returned.
+func (d *Database) GetReportQueue(status string, reason string, limit int) ([]model.ReportedPost, error) {
+	rows, err := DB.Query(`SELECT `+reportColumns+`,
+			tp.ThreadId, tp.UserId, pu.Username, tp.Body, tp.PostedAt
+		FROM board.report br
+		INNER JOIN board.user ru ON br.ReporterId = ru.Id
+		LEFT JOIN board.user mu ON br.ResolvedBy = mu.Id
+		INNER JOIN board.thread_post tp ON br.PostId = tp.Id
+		INNER JOIN board.user pu ON tp.UserId = pu.Id
+		WHERE ($1 = '' OR br.Status = $1) AND ($2 = '' OR br.Reason = $2)
+		AND br.PostId IN (
+			SELECT PostId FROM board.report
+			WHERE ($1 = '' OR Status = $1) AND ($2 = '' OR Reason = $2)
+			GROUP BY PostId
+			ORDER BY max(CreatedAt) DESC
+			LIMIT $3)
+		ORDER BY br.CreatedAt DESC`, status, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []model.ReportedPost{}
+	index := make(map[string]int)
+	for rows.Next() {
+		r := model.Report{}
+		p := model.Post{}
+		if err := rows.Scan(&r.Id, &r.PostId, &r.ReporterId, &r.ReporterName, &r.Reason, &r.Details, &r.Status,
+			&r.CreatedAt, &r.ResolvedBy, &r.ResolvedByName, &r.ResolvedAt, &r.Resolution,
+			&p.ThreadId, &p.UserId, &p.UserName, &p.Body, &p.PostedAt); err != nil {
+			return nil, err
+		}
+
+		// Reports are newest first, so posts end up in the order they were last reported
+		i, ok := index[r.PostId]
+		if !ok {
+			p.Id = r.PostId
+			i = len(queue)
+			index[r.PostId] = i
+			queue = append(queue, model.ReportedPost{Post: p})
+		}
+		queue[i].Reports = append(queue[i].Reports, r)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return queue, nil
+}
+
+// ResolveReports resolves every open report about a post, recording which mod did it and what they did.
+func (d *Database) ResolveReports(postID string, modID string, status constants.ReportStatus, resolution string) (err error) {
+	sqlStatement := `
+		UPDATE board.report
+		SET Status = $1, Resolution = $2, ResolvedBy = $3, ResolvedAt = now()
+		WHERE PostId = $4 AND Status = $5`
+
+	res, err := DB.Exec(sqlStatement, status, resolution, modID, postID, constants.ReportOpen)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoReport
+	}
+
+	return nil
+}
+
+// AppendModLog adds an entry to the mod log, setting its ID and when it was made.
+func (d *Database) AppendModLog(e *model.ModLogEntry) (err error) {
+	before, err := nullableJSON(e.Before)
+	if err != nil {
+		return err
+	}
+
+	after, err := nullableJSON(e.After)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO board.mod_log
+		(ActorId, Action, TargetType, TargetId, Reason, Before, After)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+		RETURNING Id, CreatedAt`
+
+	return DB.QueryRow(sqlStatement, e.ActorId, e.Action, e.TargetType, e.TargetId, e.Reason, before, after).
+		Scan(&e.Id, &e.CreatedAt)
+}
+
+// GetModLog returns the most recent mod log entries matching a filter, newest first.
+func (d *Database) GetModLog(f model.ModLogFilter) ([]model.ModLogEntry, error) {
+	rows, err := DB.Query(`SELECT ml.Id, ml.ActorId, bu.Username, ml.Action, ml.TargetType,
+			COALESCE(ml.TargetId, ''), COALESCE(
+				CASE ml.TargetType
+				WHEN 'thread' THEN (SELECT bc.RequiredRole FROM board.thread bt
+					INNER JOIN board.category bc ON bt.CategoryId = bc.Id
+					WHERE bt.Id::text = ml.TargetId)
+				WHEN 'post' THEN (SELECT bc.RequiredRole FROM board.thread_post tp
+					INNER JOIN board.thread bt ON tp.ThreadId = bt.Id
+					INNER JOIN board.category bc ON bt.CategoryId = bc.Id
+					WHERE tp.Id::text = ml.TargetId)
+				WHEN 'category' THEN (SELECT RequiredRole FROM board.category WHERE Id::text = ml.TargetId)
+				END, $6),
+			ml.Reason, ml.Before, ml.After, ml.CreatedAt
+		FROM board.mod_log ml
+		INNER JOIN board.user bu ON ml.ActorId = bu.Id
+		WHERE ($1 = '' OR ml.Action = $1)
+		AND ($2 = '' OR ml.ActorId::text = $2)
+		AND ($3 = '' OR ml.TargetType = $3)
+		AND ($4 = '' OR ml.TargetId = $4)
+		ORDER BY ml.CreatedAt DESC
+		LIMIT $5`, f.Action, f.ActorId, f.TargetType, f.TargetId, f.Limit, constants.User)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.ModLogEntry{}
+	for rows.Next() {
+		e := model.ModLogEntry{}
+		var before, after []byte
+		if err := rows.Scan(&e.Id, &e.ActorId, &e.ActorName, &e.Action, &e.TargetType, &e.TargetId,
+			&e.TargetRequiredRole, &e.Reason, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if before != nil {
+			e.Before = json.RawMessage(before)
+		}
+		if after != nil {
+			e.After = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return entries, nil
+}
+
+// CreateSanction sanctions a user starting now, for the given duration or until it's lifted when the
+// duration is 0. It sets the sanction's ID and times.
+func (d *Database) CreateSanction(sanction *model.Sanction, duration time.Duration) (err error) {
+	sqlStatement := `
+		INSERT INTO board.sanction
+		(UserId, Type, Reason, IssuedBy, EndsAt)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 > 0 THEN now() + $5 * interval '1 second' END)
+		RETURNING ` + sanctionColumns
+
+	rows, err := DB.Query(sqlStatement, sanction.UserId, sanction.Type, sanction.Reason, sanction.IssuedBy,
+		int64(duration.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	sanctions, err := scanSanctions(rows)
+	if err != nil {
+		return err
+	}
+	if len(sanctions) == 0 {
+		return sql.ErrNoRows
+	}
+
+	*sanction = sanctions[0]
+	return nil
+}
+
+// GetActiveSanctions returns the sanctions a user is under right now.
+func (d *Database) GetActiveSanctions(userID string) ([]model.Sanction, error) {
+	rows, err := DB.Query(`SELECT `+sanctionColumns+`
+		FROM board.sanction
+		WHERE UserId = $1 AND LiftedAt IS NULL AND StartsAt <= now() AND (EndsAt IS NULL OR EndsAt > now())
+		ORDER BY CreatedAt DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSanctions(rows)
+}
+
+// GetSanctions returns every sanction a user has been under, newest first.
+func (d *Database) GetSanctions(userID string) ([]model.Sanction, error) {
+	rows, err := DB.Query(`SELECT `+sanctionColumns+`
+		FROM board.sanction
+		WHERE UserId = $1
+		ORDER BY CreatedAt DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSanctions(rows)
+}
+
+// GetSanction returns a sanction, whether or not it's still active.
+func (d *Database) GetSanction(sanctionID string) (model.Sanction, error) {
+	rows, err := DB.Query(`SELECT `+sanctionColumns+`
+		FROM board.sanction
+		WHERE Id = $1`, sanctionID)
+	if err != nil {
+		return model.Sanction{}, err
+	}
+
+	sanctions, err := scanSanctions(rows)
+	if err != nil {
+		return model.Sanction{}, err
+	}
+	if len(sanctions) == 0 {
+		return model.Sanction{}, ErrNoSanction
+	}
+
+	return sanctions[0], nil
+}
+
+// LiftSanction ends a sanction early.
+func (d *Database) LiftSanction(sanctionID string, liftedBy string) (model.Sanction, error) {
+	rows, err := DB.Query(`
+		UPDATE board.sanction
+		SET LiftedAt = now(), LiftedBy = $1
+		WHERE Id = $2 AND LiftedAt IS NULL
+		RETURNING `+sanctionColumns, liftedBy, sanctionID)
+	if err != nil {
+		return model.Sanction{}, err
+	}
+
+	sanctions, err := scanSanctions(rows)
+	if err != nil {
+		return model.Sanction{}, err
+	}
+	if len(sanctions) == 0 {
+		return model.Sanction{}, ErrNoSanction
+	}
+
+	return sanctions[0], nil
+}
+
+// ExpireSanctions marks sanctions that have run out as lifted, returning them. Sanctions stop applying
+// when they end either way, this just records it.
+func (d *Database) ExpireSanctions() ([]model.Sanction, error) {
+	rows, err := DB.Query(`
+		UPDATE board.sanction
+		SET LiftedAt = EndsAt
+		WHERE LiftedAt IS NULL AND EndsAt <= now()
+		RETURNING ` + sanctionColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSanctions(rows)
+}
+
+// HasPermission reports whether a role has a permission. When a category is given, an override for that
+// category takes precedence over the role's permissions everywhere else.
+func (d *Database) HasPermission(role constants.Role, permission constants.Permission, categoryID string) (bool, error) {
+	var allowed bool
+	err := DB.QueryRow(`
+		SELECT COALESCE(
+			(SELECT Allowed FROM board.category_permission
+				WHERE CategoryId = NULLIF($3, '')::uuid AND Role = $1 AND Permission = $2),
+			EXISTS (SELECT 1 FROM board.role_permission WHERE Role = $1 AND Permission = $2))`,
+		role, permission, categoryID).Scan(&allowed)
+
+	return allowed, err
+}
+
+// GetRolePermissions returns the permissions of every role that has any.
+func (d *Database) GetRolePermissions() ([]model.RolePermissions, error) {
+	rows, err := DB.Query(`
+		SELECT Role, array_agg(Permission ORDER BY Permission)
+		FROM board.role_permission
+		GROUP BY Role
+		ORDER BY Role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []model.RolePermissions{}
+	for rows.Next() {
+		r := model.RolePermissions{}
+		if err := rows.Scan(&r.Role, pq.Array(&r.Permissions)); err != nil {
+			return nil, err
+		}
+		r.RoleName = constants.Role(r.Role).String()
+		roles = append(roles, r)
+	}
+
+	return roles, rows.Err()
+}
+
+// SetRolePermissions replaces the permissions a role has everywhere on the board.
+func (d *Database) SetRolePermissions(role constants.Role, permissions []string) (err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM board.role_permission WHERE Role = $1`, role); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(permissions) > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO board.role_permission (Role, Permission)
+			SELECT $1, unnest($2::varchar[])`, role, pq.Array(permissions))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetCategoryPermissions returns the overrides of role permissions in a category.
+func (d *Database) GetCategoryPermissions(categoryID string) ([]model.CategoryPermission, error) {
+	rows, err := DB.Query(`
+		SELECT Role, Permission, Allowed
+		FROM board.category_permission
+		WHERE CategoryId = $1
+		ORDER BY Role, Permission`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []model.CategoryPermission{}
+	for rows.Next() {
+		o := model.CategoryPermission{}
+		if err := rows.Scan(&o.Role, &o.Permission, &o.Allowed); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+
+	return overrides, rows.Err()
+}
+
+// SetCategoryPermissions replaces the overrides of role permissions in a category.
+func (d *Database) SetCategoryPermissions(categoryID string, overrides []model.CategoryPermission) (err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM board.category_permission WHERE CategoryId = $1`, categoryID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, o := range overrides {
+		_, err = tx.Exec(`
+			INSERT INTO board.category_permission (CategoryId, Role, Permission, Allowed)
+			VALUES ($1, $2, $3, $4)`, categoryID, o.Role, o.Permission, o.Allowed)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetThreadCategoryID returns the category a thread is in, even if the thread has been deleted.
+func (d *Database) GetThreadCategoryID(threadID string) (categoryID string, err error) {
+	err = DB.QueryRow(`SELECT CategoryId FROM board.thread WHERE Id = $1`, threadID).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return "", ErrNoThread
+	}
+
+	return categoryID, err
+}
+
+// GetPostCategoryID returns the category of the thread a post is in, even if the post has been deleted.
+func (d *Database) GetPostCategoryID(postID string) (categoryID string, err error) {
+	err = DB.QueryRow(`
+		SELECT bt.CategoryId
+		FROM board.thread_post tp
+		INNER JOIN board.thread bt ON tp.ThreadId = bt.Id
+		WHERE tp.Id = $1`, postID).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return "", ErrNoPost
+	}
+
+	return categoryID, err
+}
+
+// CreateNotification saves a notification for a user, setting its ID, when it was created and the name of
+// the user who caused it.
+func (d *Database) CreateNotification(n *model.Notification) (err error) {
+	sqlStatement := `
+		INSERT INTO board.notification
+		(UserId, Type, ActorId, TargetId, PostId, Text)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, $6)
+		RETURNING Id, CreatedAt, COALESCE((SELECT Username FROM board.user WHERE Id = ActorId), '')`
+
+	return DB.QueryRow(sqlStatement, n.UserId, n.Type, n.ActorId, n.TargetId, n.PostId, n.Text).
+		Scan(&n.Id, &n.CreatedAt, &n.ActorName)
+}
+
+// GetNotifications returns a user's most recent notifications, newest first.
+func (d *Database) GetNotifications(userID string, unreadOnly bool, limit int) ([]model.Notification, error) {
+	rows, err := DB.Query(`
+		SELECT `+notificationColumns+`
+		FROM board.notification bn
+		LEFT JOIN board.user bu ON bn.ActorId = bu.Id
+		WHERE bn.UserId = $1 AND ($2 = false OR bn.ReadAt IS NULL)
+		ORDER BY bn.CreatedAt DESC
+		LIMIT $3`, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanNotifications(rows)
+}
+
+// CountUnreadNotifications returns how many notifications a user hasn't read.
+func (d *Database) CountUnreadNotifications(userID string) (count int, err error) {
+	err = DB.QueryRow(`SELECT count(*) FROM board.notification
+		WHERE UserId = $1 AND ReadAt IS NULL`, userID).
+		Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkNotificationRead marks one of a user's notifications as read.
+func (d *Database) MarkNotificationRead(userID string, notificationID string) (err error) {
+	sqlStatement := `
+		UPDATE board.notification
+		SET ReadAt = COALESCE(ReadAt, now())
+		WHERE Id = $1 AND UserId = $2`
+
+	res, err := DB.Exec(sqlStatement, notificationID, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNoNotification
+	}
+
+	return nil
+}
+
+// MarkAllNotificationsRead marks every notification a user hasn't read as read.
+func (d *Database) MarkAllNotificationsRead(userID string) (err error) {
+	sqlStatement := `
+		UPDATE board.notification
+		SET ReadAt = now()
+		WHERE UserId = $1 AND ReadAt IS NULL`
+
+	_, err = DB.Exec(sqlStatement, userID)
+	return err
+}
+
+// AppendEvent adds an event to the event log and sets its sequence number. Every so often events that
+// have fallen out of the log are deleted.
+func (d *Database) AppendEvent(e *model.Event) (err error) {
+	payload, err := json.Marshal(e.Payload)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO board.event_log
+		(Id, Version, Topic, Type, Payload, OccurredAt)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING Seq`
+	err = DB.QueryRow(sqlStatement, e.Id, e.Version, e.Topic, e.Type, payload, e.OccurredAt).Scan(&e.Seq)
+	if err != nil {
+		return err
+	}
+
+	prunedAt := atomic.LoadInt64(&eventLogPrunedAt)
+	boundary := e.Seq - e.Seq%eventLogPruneInterval
+	if boundary > prunedAt && atomic.CompareAndSwapInt64(&eventLogPrunedAt, prunedAt, boundary) {
+		_, err = DB.Exec(`DELETE FROM board.event_log WHERE Seq <= $1`, boundary-eventLogSize)
+	}
+
+	return err
+}
+
+// GetEventsSince retrieves events on any of the topics that were logged after the given sequence number,
+// oldest first.
+func (d *Database) GetEventsSince(seq int64, topics []string, limit int) ([]model.Event, error) {
+	rows, err := DB.Query(`
+		SELECT Seq, Id, Version, Topic, Type, Payload, OccurredAt
+		FROM board.event_log
+		WHERE Seq > $1 AND Topic = ANY($2)
+		ORDER BY Seq
+		LIMIT $3`, seq, pq.Array(topics), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.Event, 0)
+	for rows.Next() {
+		var e model.Event
+		var payload []byte
+		err = rows.Scan(&e.Seq, &e.Id, &e.Version, &e.Topic, &e.Type, &payload, &e.OccurredAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// HandlePasswordMigration will check a user's password against their hashed MD5 password from the legacy site. If
+// it's a match, it will encrypt their password with bcrypt and delete the hashed password.
 func (d *Database) HandlePasswordMigration(user *model.User, credentials *model.Credentials) error {
 	if user.UserPasswordMd5.Valid {
 		hashed := user.HashPasswordMd5(credentials.Password)
@@ -644,3 +2066,267 @@ func (d *Database) openConnection(psqlInfo string) error {
 	}
 	return nil
 }
+
+func (d *Database) getPostsAfter(threadID string, after string, limit int) (page model.PostPage, err error) {
+	var rows *sql.Rows
+	var cursor model.PostCursor
+	if after == "" {
+		rows, err = DB.Query(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
+			FROM board.thread_post tp
+			INNER JOIN board.user bu ON tp.UserId = bu.Id
+			WHERE tp.ThreadId = $1
+			ORDER BY tp.PostedAt, tp.Id LIMIT $2`, threadID, limit+1)
+	} else {
+		cursor, err = model.DecodePostCursor(after)
+		if err != nil {
+			return page, err
+		}
+		rows, err = DB.Query(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
+			FROM board.thread_post tp
+			INNER JOIN board.user bu ON tp.UserId = bu.Id
+			WHERE tp.ThreadId = $1 AND (tp.PostedAt, tp.Id) > ($2, $3)
+			ORDER BY tp.PostedAt, tp.Id LIMIT $4`, threadID, cursor.PostedAt, cursor.Id, limit+1)
+	}
+	if err != nil {
+		return page, err
+	}
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return page, err
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	return newPostPage(posts, after != "", hasMore), nil
+}
+
+func (d *Database) getPostsBefore(threadID string, before string, limit int) (page model.PostPage, err error) {
+	cursor, err := model.DecodePostCursor(before)
+	if err != nil {
+		return page, err
+	}
+
+	rows, err := DB.Query(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
+			FROM board.thread_post tp
+			INNER JOIN board.user bu ON tp.UserId = bu.Id
+			WHERE tp.ThreadId = $1 AND (tp.PostedAt, tp.Id) < ($2, $3)
+			ORDER BY tp.PostedAt DESC, tp.Id DESC LIMIT $4`, threadID, cursor.PostedAt, cursor.Id, limit+1)
+	if err != nil {
+		return page, err
+	}
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return page, err
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+
+	return newPostPage(posts, hasMore, true), nil
+}
+
+// getPostsAround finds the page containing the given post, with pages aligned as if the client
+// had paged forward from the start of the thread.
+func (d *Database) getPostsAround(threadID string, postID string, limit int) (page model.PostPage, err error) {
+	var position int
+	err = DB.QueryRow(`SELECT COUNT(tp.Id)
+			FROM board.thread_post target
+			LEFT JOIN board.thread_post tp ON tp.ThreadId = target.ThreadId
+				AND (tp.PostedAt, tp.Id) < (target.PostedAt, target.Id)
+			WHERE target.Id = $1 AND target.ThreadId = $2
+			GROUP BY target.Id`, postID, threadID).
+		Scan(&position)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return page, ErrNoPost
+		}
+		return page, err
+	}
+
+	offset := (position / limit) * limit
+
+	rows, err := DB.Query(`SELECT tp.Id, tp.ThreadId, tp.UserId, tp.Body, tp.PostedAt, bu.Username
+			FROM board.thread_post tp
+			INNER JOIN board.user bu ON tp.UserId = bu.Id
+			WHERE tp.ThreadId = $1
+			ORDER BY tp.PostedAt, tp.Id LIMIT $2 OFFSET $3`, threadID, limit+1, offset)
+	if err != nil {
+		return page, err
+	}
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return page, err
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	return newPostPage(posts, offset > 0, hasMore), nil
+}
+
+func newPostPage(posts []model.Post, hasPrev bool, hasNext bool) model.PostPage {
+	page := model.PostPage{Posts: posts}
+	if len(posts) == 0 {
+		return page
+	}
+
+	if hasPrev {
+		first := posts[0]
+		page.PrevCursor = model.PostCursor{PostedAt: first.PostedAt, Id: first.Id}.Encode()
+	}
+	if hasNext {
+		last := posts[len(posts)-1]
+		page.NextCursor = model.PostCursor{PostedAt: last.PostedAt, Id: last.Id}.Encode()
+	}
+
+	return page
+}
+
+func scanPosts(rows *sql.Rows) ([]model.Post, error) {
+	defer rows.Close()
+
+	var posts []model.Post
+	for rows.Next() {
+		p := model.Post{}
+		if err := rows.Scan(&p.Id, &p.ThreadId, &p.UserId, &p.Body, &p.PostedAt, &p.UserName); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return posts, nil
+}
+
+// sinceTime converts a millisecond unix timestamp string into a time.
+func sinceTime(since string) time.Time {
+	i, _ := strconv.ParseInt(since, 10, 64)
+
+	return time.Unix(0, i*int64(time.Millisecond))
+}
+
+func scanThreads(rows *sql.Rows) ([]model.Thread, error) {
+	defer rows.Close()
+
+	var threads []model.Thread
+	for rows.Next() {
+		t := model.Thread{}
+		if err := rows.Scan(&t.Id, &t.UserId, &t.Title, &t.PostedAt, &t.UserName, &t.LastPostedAt, &t.CategoryId); err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return threads, nil
+}
+
+const reportColumns = `br.Id, br.PostId, br.ReporterId, ru.Username, br.Reason, br.Details, br.Status,
+	br.CreatedAt, COALESCE(br.ResolvedBy::text, ''), COALESCE(mu.Username, ''), br.ResolvedAt, br.Resolution`
+
+const sanctionColumns = `Id, UserId, Type, Reason, IssuedBy, COALESCE((SELECT Username FROM board.user WHERE Id = IssuedBy), ''),
+	StartsAt, EndsAt, CreatedAt, LiftedAt, COALESCE(LiftedBy::text, '')`
+
+func scanSanctions(rows *sql.Rows) ([]model.Sanction, error) {
+	defer rows.Close()
+
+	sanctions := []model.Sanction{}
+	for rows.Next() {
+		s := model.Sanction{}
+		if err := rows.Scan(&s.Id, &s.UserId, &s.Type, &s.Reason, &s.IssuedBy, &s.IssuedByName, &s.StartsAt,
+			&s.EndsAt, &s.CreatedAt, &s.LiftedAt, &s.LiftedBy); err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, s)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return sanctions, nil
+}
+
+const notificationColumns = `bn.Id, bn.UserId, bn.Type, COALESCE(bn.ActorId::text, ''), COALESCE(bu.Username, ''),
+	COALESCE(bn.TargetId::text, ''), COALESCE(bn.PostId::text, ''), bn.Text, bn.CreatedAt, bn.ReadAt`
+
+func scanNotifications(rows *sql.Rows) ([]model.Notification, error) {
+	defer rows.Close()
+
+	notifications := []model.Notification{}
+	for rows.Next() {
+		n := model.Notification{}
+		if err := rows.Scan(&n.Id, &n.UserId, &n.Type, &n.ActorId, &n.ActorName, &n.TargetId, &n.PostId,
+			&n.Text, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return notifications, nil
+}
+
+const outboxEmailColumns = `Id, Template, Recipient, RecipientName, Subject, Data, Status, Attempts, LastError,
+	NextAttemptAt, CreatedAt, SentAt`
+
+func scanOutboxEmails(rows *sql.Rows) ([]model.OutboxEmail, error) {
+	defer rows.Close()
+
+	emails := []model.OutboxEmail{}
+	for rows.Next() {
+		e := model.OutboxEmail{}
+		var data []byte
+		if err := rows.Scan(&e.Id, &e.Template, &e.Recipient, &e.RecipientName, &e.Subject, &data, &e.Status,
+			&e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.SentAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e.Data); err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return emails, nil
+}
+
+// nullableJSON marshals a value for a jsonb column, leaving nil as NULL rather than JSON null.
+func nullableJSON(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+// newConfirmCode generates a random, URL safe code for confirming an account.
+func newConfirmCode() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
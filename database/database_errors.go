@@ -8,3 +8,35 @@ var ErrEditPost = errors.New("Posts can only be edited for 10 minutes")
 var ErrNoThread = errors.New("Couldn't find that thread")
 // ErrWrongPassword when a user enters a password that doesn't match
 var ErrWrongPassword = errors.New("Wrong password")
+// ErrNoPost occurs when a post doesn't exist
+var ErrNoPost = errors.New("Couldn't find that post")
+// ErrNoCategory occurs when a category doesn't exist
+var ErrNoCategory = errors.New("Couldn't find that category")
+// ErrCategoryArchived occurs when a user tries to post a thread or reply in an archived category
+var ErrCategoryArchived = errors.New("That category has been archived")
+// ErrInvalidResetToken occurs when a password reset token is unknown, expired or already used
+var ErrInvalidResetToken = errors.New("That password reset link is invalid or has expired")
+// ErrNoEmail occurs when an email isn't in the outbox, or isn't in a state that allows the action
+var ErrNoEmail = errors.New("Couldn't find that email")
+// ErrPasswordResetThrottled occurs when a user asks for another password reset too soon after the last one
+var ErrPasswordResetThrottled = errors.New("A password reset email was sent recently")
+// ErrConfirmCodeExpired occurs when a user tries to confirm their account with a code that has expired
+var ErrConfirmCodeExpired = errors.New("Confirmation code has expired")
+// ErrConfirmThrottled occurs when a user asks for a new confirmation code too soon after the last one
+var ErrConfirmThrottled = errors.New("A confirmation email was sent recently")
+// ErrInvalidRefreshToken occurs when a refresh token is unknown or has expired
+var ErrInvalidRefreshToken = errors.New("Invalid or expired refresh token")
+// ErrRefreshTokenReused occurs when a refresh token that has already been rotated or revoked is used again
+var ErrRefreshTokenReused = errors.New("Refresh token has already been used")
+// ErrNoNotification occurs when a notification doesn't exist, or belongs to someone else
+var ErrNoNotification = errors.New("Couldn't find that notification")
+// ErrNoUser occurs when a user doesn't exist
+var ErrNoUser = errors.New("Couldn't find that user")
+// ErrNoReport occurs when a report doesn't exist, or there are no open reports to resolve
+var ErrNoReport = errors.New("Couldn't find that report")
+// ErrAlreadyReported occurs when a user reports a post they already have an open report about
+var ErrAlreadyReported = errors.New("You've already reported that post")
+// ErrLastAdmin occurs when someone tries to take the admin role away from the only admin left
+var ErrLastAdmin = errors.New("The last admin can't be given another role")
+// ErrNoSanction occurs when a sanction doesn't exist, or has already been lifted
+var ErrNoSanction = errors.New("Couldn't find that sanction")
@@ -3,8 +3,10 @@ package database
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DarthHater/bored-board-service/constants"
 	"github.com/DarthHater/bored-board-service/model"
@@ -57,14 +59,14 @@ func TestGetThread(t *testing.T) {
 	}
 	defer DB.Close()
 
-	row := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username"}).
-		AddRow("", "admin", "What the heck", "A time", "admin")
+	row := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username", "categoryid"}).
+		AddRow("", "admin", "What the heck", "A time", "admin", "1")
 
 	mock.ExpectQuery("SELECT (.+) FROM board.thread").WillReturnRows(row)
 
 	result, err := d.GetThread("a thread")
 
-	expected := model.Thread{Id: "", UserId: "admin", Title: "What the heck", PostedAt: "A time", UserName: "admin"}
+	expected := model.Thread{Id: "", UserId: "admin", Title: "What the heck", PostedAt: "A time", UserName: "admin", CategoryId: "1"}
 
 	assert.Equal(t, result, expected)
 
@@ -125,6 +127,28 @@ func TestGetPost(t *testing.T) {
 	}
 }
 
+func TestGetPostMissing(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread_post").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "threadid", "userid", "body", "postedat", "username"}))
+
+	_, err = d.GetPost("nope")
+
+	assert.Equal(t, ErrNoPost, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
 func TestGetThreads(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
@@ -135,17 +159,79 @@ func TestGetThreads(t *testing.T) {
 	}
 	defer DB.Close()
 
-	row := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username", "lastpostedat"}).
-		AddRow("", "admin", "What the heck", "A time", "admin", "A time").
-		AddRow("", "admin", "DJ Khaled", "A time", "admin", "A time")
+	row := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username", "lastpostedat", "categoryid"}).
+		AddRow("", "admin", "What the heck", "A time", "admin", "A time", "1").
+		AddRow("", "admin", "DJ Khaled", "A time", "admin", "A time", "1")
 
-	mock.ExpectQuery("SELECT (.+) FROM board.thread").WillReturnRows(row)
+	mock.ExpectQuery("SELECT (.+) FROM board.thread").
+		WithArgs(sqlmock.AnyArg(), constants.User, 20).
+		WillReturnRows(row)
+
+	result, err := d.GetThreads(20, "", constants.Muted)
+
+	expected := []model.Thread{
+		{Id: "", UserId: "admin", Title: "What the heck", PostedAt: "A time", UserName: "admin", LastPostedAt: "A time", CategoryId: "1"},
+		{Id: "", UserId: "admin", Title: "DJ Khaled", PostedAt: "A time", UserName: "admin", LastPostedAt: "A time", CategoryId: "1"},
+	}
+
+	assert.Equal(t, result, expected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
 
-	result, err := d.GetThreads(20, "")
+func TestGetCategoryThreads(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	row := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username", "lastpostedat", "categoryid"}).
+		AddRow("", "admin", "What the heck", "A time", "admin", "A time", "elite")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread").
+		WithArgs("elite", sqlmock.AnyArg(), 20).
+		WillReturnRows(row)
+
+	result, err := d.GetCategoryThreads("elite", 20, "")
 
 	expected := []model.Thread{
-		{Id: "", UserId: "admin", Title: "What the heck", PostedAt: "A time", UserName: "admin", LastPostedAt: "A time"},
-		{Id: "", UserId: "admin", Title: "DJ Khaled", PostedAt: "A time", UserName: "admin", LastPostedAt: "A time"},
+		{Id: "", UserId: "admin", Title: "What the heck", PostedAt: "A time", UserName: "admin", LastPostedAt: "A time", CategoryId: "elite"},
+	}
+
+	assert.Equal(t, result, expected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestGetCategories(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	row := sqlmock.NewRows([]string{"id", "title", "description", "sortorder", "requiredrole", "isdefault", "archived"}).
+		AddRow("1", "General", "Anything and everything", 0, 3, true, false).
+		AddRow("2", "Elite", "Elite only", 1, 2, false, false)
+
+	mock.ExpectQuery("SELECT (.+) FROM board.category").WithArgs(constants.Elite).WillReturnRows(row)
+
+	result, err := d.GetCategories(constants.Elite)
+
+	expected := []model.Category{
+		{Id: "1", Title: "General", Description: "Anything and everything", SortOrder: 0, RequiredRole: 3, IsDefault: true},
+		{Id: "2", Title: "Elite", Description: "Elite only", SortOrder: 1, RequiredRole: 2},
 	}
 
 	assert.Equal(t, result, expected)
@@ -155,6 +241,128 @@ func TestGetThreads(t *testing.T) {
 	}
 }
 
+func TestGetCategoryMissing(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM board.category").
+		WithArgs("nope").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "sortorder", "requiredrole", "isdefault", "archived"}))
+
+	_, err = d.GetCategory("nope")
+
+	assert.Equal(t, ErrNoCategory, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestPostCategory(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	category := model.Category{Title: "Elite", Description: "Elite only", RequiredRole: int(constants.Elite)}
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("INSERT INTO board.category").WithArgs(
+		category.Title,
+		category.Description,
+		category.RequiredRole).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "sortorder", "requiredrole", "isdefault", "archived"}).
+			AddRow("2", "Elite", "Elite only", 1, 2, false, false))
+
+	result, err := d.PostCategory(&category)
+
+	if err != nil {
+		t.Errorf("Error was not expected while inserting category: %s", err)
+	}
+
+	assert.Equal(t, model.Category{Id: "2", Title: "Elite", Description: "Elite only", SortOrder: 1, RequiredRole: 2}, result)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReorderCategories(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE board.category").WithArgs(0, "2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE board.category").WithArgs(1, "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err = d.ReorderCategories([]string{"2", "1"}); err != nil {
+		t.Errorf("Error was not expected while reordering categories: %s", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReorderCategoriesMissing(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE board.category").WithArgs(0, "nope").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = d.ReorderCategories([]string{"nope"})
+
+	assert.Equal(t, ErrNoCategory, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestArchiveCategory(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.category").WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err = d.ArchiveCategory("2"); err != nil {
+		t.Errorf("Error was not expected while archiving category: %s", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestGetPosts(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
@@ -169,13 +377,15 @@ func TestGetPosts(t *testing.T) {
 		AddRow("", "", "", "Post Body", "A time", "admin").
 		AddRow("", "", "", "Post Body 2", "A time", "admin")
 
-	mock.ExpectQuery("SELECT (.+) FROM board.thread_post").WillReturnRows(row)
+	mock.ExpectQuery("SELECT (.+) FROM board.thread_post").WithArgs("A thread", 3).WillReturnRows(row)
 
-	result, err := d.GetPosts("A thread")
+	result, err := d.GetPosts("A thread", model.PostPageRequest{Limit: 2})
 
-	expected := []model.Post{
-		{Id: "", ThreadId: "", UserId: "", Body: "Post Body", PostedAt: "A time", UserName: "admin"},
-		{Id: "", ThreadId: "", UserId: "", Body: "Post Body 2", PostedAt: "A time", UserName: "admin"},
+	expected := model.PostPage{
+		Posts: []model.Post{
+			{Id: "", ThreadId: "", UserId: "", Body: "Post Body", PostedAt: "A time", UserName: "admin"},
+			{Id: "", ThreadId: "", UserId: "", Body: "Post Body 2", PostedAt: "A time", UserName: "admin"},
+		},
 	}
 
 	assert.Equal(t, result, expected)
@@ -185,6 +395,125 @@ func TestGetPosts(t *testing.T) {
 	}
 }
 
+func TestGetPostsAfterCursor(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	row := sqlmock.NewRows([]string{"id", "threadid", "userid", "body", "postedat", "username"}).
+		AddRow("3", "", "", "Post Body 3", "Time 3", "admin").
+		AddRow("4", "", "", "Post Body 4", "Time 4", "admin").
+		AddRow("5", "", "", "Post Body 5", "Time 5", "admin")
+
+	mock.ExpectQuery(`SELECT (.+) FROM board.thread_post (.+) \(tp.PostedAt, tp.Id\) >`).
+		WithArgs("A thread", "Time 2", "2", 3).
+		WillReturnRows(row)
+
+	after := model.PostCursor{PostedAt: "Time 2", Id: "2"}.Encode()
+	result, err := d.GetPosts("A thread", model.PostPageRequest{After: after, Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Posts, 2)
+	assert.Equal(t, model.PostCursor{PostedAt: "Time 3", Id: "3"}.Encode(), result.PrevCursor)
+	assert.Equal(t, model.PostCursor{PostedAt: "Time 4", Id: "4"}.Encode(), result.NextCursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestGetPostsBeforeCursor(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	row := sqlmock.NewRows([]string{"id", "threadid", "userid", "body", "postedat", "username"}).
+		AddRow("2", "", "", "Post Body 2", "Time 2", "admin").
+		AddRow("1", "", "", "Post Body 1", "Time 1", "admin")
+
+	mock.ExpectQuery(`SELECT (.+) FROM board.thread_post (.+) \(tp.PostedAt, tp.Id\) <`).
+		WithArgs("A thread", "Time 3", "3", 3).
+		WillReturnRows(row)
+
+	before := model.PostCursor{PostedAt: "Time 3", Id: "3"}.Encode()
+	result, err := d.GetPosts("A thread", model.PostPageRequest{Before: before, Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", result.Posts[0].Id)
+	assert.Equal(t, "2", result.Posts[1].Id)
+	assert.Equal(t, "", result.PrevCursor)
+	assert.Equal(t, model.PostCursor{PostedAt: "Time 2", Id: "2"}.Encode(), result.NextCursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestGetPostsAroundPost(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(tp.Id\) FROM board.thread_post`).
+		WithArgs("5", "A thread").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	row := sqlmock.NewRows([]string{"id", "threadid", "userid", "body", "postedat", "username"}).
+		AddRow("5", "", "", "Post Body 5", "Time 5", "admin")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread_post (.+) OFFSET").
+		WithArgs("A thread", 3, 4).
+		WillReturnRows(row)
+
+	result, err := d.GetPosts("A thread", model.PostPageRequest{Around: "5", Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Posts, 1)
+	assert.Equal(t, model.PostCursor{PostedAt: "Time 5", Id: "5"}.Encode(), result.PrevCursor)
+	assert.Equal(t, "", result.NextCursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestGetPostsAroundMissingPost(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(tp.Id\) FROM board.thread_post`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}))
+
+	_, err = d.GetPosts("A thread", model.PostPageRequest{Around: "nope", Limit: 2})
+
+	assert.Equal(t, ErrNoPost, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
 func TestGetMessages(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
@@ -245,6 +574,30 @@ func TestGetMessagePosts(t *testing.T) {
 	}
 }
 
+func TestIsMessageMember(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT EXISTS (.+) FROM board.message_member").
+		WithArgs("message", "user").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	member, err := d.IsMessageMember("message", "user")
+
+	assert.Nil(t, err)
+	assert.False(t, member)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
 func TestPostMessage(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
@@ -273,7 +626,7 @@ func TestPostMessage(t *testing.T) {
 	if id, err := d.PostMessage(&newMessage); err != nil {
 		t.Errorf("Error was not expected while inserting thread: %s", err)
 	} else {
-		t.Logf("Thread inserted with id: %s", id)
+		t.Logf("Thread inserted with id: %s", id.T.Id)
 	}
 
 	if err = mock.ExpectationsWereMet(); err != nil {
@@ -320,12 +673,13 @@ func TestPostThread(t *testing.T) {
 	}
 	defer DB.Close()
 
-	threadMock := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username"}).AddRow("", "", "Ok", "", "andy")
+	threadMock := sqlmock.NewRows([]string{"id", "userId", "title", "postedat", "username", "categoryid"}).AddRow("", "", "Ok", "", "andy", "1")
 	postMock := sqlmock.NewRows([]string{"id", "threadid", "userid", "body", "postedat", "username"}).AddRow("", "", "", "I'm Posting", "datetime", "andy")
 
 	mock.ExpectQuery("INSERT INTO board.thread").WithArgs(
+		newThread.T.UserId,
 		newThread.T.Title,
-		newThread.T.UserId).
+		newThread.T.CategoryId).
 		WillReturnRows(threadMock)
 
 	mock.ExpectQuery("INSERT INTO board.thread_post").WithArgs(
@@ -337,7 +691,7 @@ func TestPostThread(t *testing.T) {
 	if id, err := d.PostThread(&newThread); err != nil {
 		t.Errorf("Error was not expected while inserting thread: %s", err)
 	} else {
-		t.Logf("Thread inserted with id: %s", id)
+		t.Logf("Thread inserted with id: %s", id.T.Id)
 	}
 
 	if err = mock.ExpectationsWereMet(); err != nil {
@@ -470,7 +824,7 @@ func TestGetUser(t *testing.T) {
 	}
 }
 
-func TestGetUsers(t *testing.T) {
+func TestGetUserByID(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
 	var err error
@@ -480,17 +834,43 @@ func TestGetUsers(t *testing.T) {
 	}
 	defer DB.Close()
 
-	row := sqlmock.NewRows([]string{"id", "username"}).
-		AddRow("1", "CoolGuy420").
-		AddRow("2", "CoolGuyChiller")
+	row := sqlmock.NewRows([]string{"id", "username", "emailaddress", "userpassword", "userrole", "userpasswordmd5"}).
+		AddRow("1", "CoolGuy420", "hsimpson@springfield.org", []byte("fake password"), constants.Muted, sql.NullString{})
 
-	mock.ExpectQuery(`SELECT (.+) FROM \(SELECT (.+) FROM board.user\)`).WillReturnRows(row)
+	mock.ExpectQuery("SELECT (.+) FROM board.user WHERE Id").WithArgs("1").WillReturnRows(row)
 
-	result, err := d.GetUsers("coolguy")
+	result, err := d.GetUserByID("1")
 
-	expected := []model.User{
-		{ID: "1", Username: "CoolGuy420"},
-		{ID: "2", Username: "CoolGuyChiller"},
+	expected := model.User{ID: "1", Username: "CoolGuy420", EmailAddress: "hsimpson@springfield.org", Password: []byte("fake password"), UserRole: int(constants.Muted), UserPasswordMd5: sql.NullString{}}
+
+	assert.Equal(t, result, expected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	row := sqlmock.NewRows([]string{"id", "username"}).
+		AddRow("1", "CoolGuy420").
+		AddRow("2", "CoolGuyChiller")
+
+	mock.ExpectQuery(`SELECT (.+) FROM \(SELECT (.+) FROM board.user\)`).WillReturnRows(row)
+
+	result, err := d.GetUsers("coolguy")
+
+	expected := []model.User{
+		{ID: "1", Username: "CoolGuy420"},
+		{ID: "2", Username: "CoolGuyChiller"},
 	}
 
 	assert.Equal(t, result, expected)
@@ -516,13 +896,15 @@ func TestCreateUser(t *testing.T) {
 		user.EmailAddress,
 		user.Password,
 		constants.NeedsConfirmation,
-		AnyInt{}).
+		sqlmock.AnyArg(),
+		int(confirmCodeLifetime.Seconds())).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
 
 	if id, confirmCode, err := d.CreateUser(&user); err != nil {
 		t.Errorf("Error was not expected while inserting user: %s", err)
 	} else {
-		t.Logf("User inserted with id: %s and confirmCode: %d", id, confirmCode)
+		assert.Len(t, confirmCode, 32)
+		t.Logf("User inserted with id: %s and confirmCode: %s", id, confirmCode)
 	}
 
 	if err = mock.ExpectationsWereMet(); err != nil {
@@ -535,7 +917,7 @@ func TestConfirmUser(t *testing.T) {
 	var mock sqlmock.Sqlmock
 	var err error
 	userID := "FakeID"
-	confirmCode := 0
+	confirmCode := "FakeCode"
 	DB, mock, err = sqlmock.New()
 	if err != nil {
 		t.Fatalf("An error %s occurred when opening stub database connection", err)
@@ -559,111 +941,1357 @@ func TestConfirmUser(t *testing.T) {
 	}
 }
 
-func TestHandleDatabaseMigrationMd5Exists(t *testing.T) {
+func TestCreatePasswordReset(t *testing.T) {
 	d := Database{}
 	var mock sqlmock.Sqlmock
 	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("INSERT INTO board.password_reset").
+		WithArgs("1", "hash", 3600, 300).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err = d.CreatePasswordReset("1", "hash", time.Hour, 5*time.Minute); err != nil {
+		t.Errorf("Error was not expected while creating password reset: %s", err)
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
 
+func TestCreatePasswordResetThrottled(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
 	DB, mock, err = sqlmock.New()
 	if err != nil {
 		t.Fatalf("An error %s occurred when opening stub database connection", err)
 	}
 	defer DB.Close()
 
-	user := model.User{
-		Username: "hi",
-		UserPasswordMd5: sql.NullString{
-			String: "E10ADC3949BA59ABBE56E057F20F883E", // "123456"
-			Valid:  true,
-		},
-		Password: nil,
-		ID:       "1",
+	mock.ExpectExec("INSERT INTO board.password_reset").
+		WithArgs("1", "hash", 3600, 300).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = d.CreatePasswordReset("1", "hash", time.Hour, 5*time.Minute)
+
+	assert.Equal(t, ErrPasswordResetThrottled, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
+}
 
-	credentials := model.Credentials{
-		Username: "hi",
-		Password: "123456",
+func TestResetPassword(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
 	}
+	defer DB.Close()
 
-	user.HashPassword(credentials.Password)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT UserId FROM board.password_reset").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow("1"))
+	mock.ExpectExec("UPDATE board.user").
+		WithArgs([]byte("new password"), "1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE board.password_reset").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
 
-	mock.ExpectExec(`UPDATE board.user`).WithArgs(
-		AnyByte{},
-		sql.NullString{},
-		"1").WillReturnResult(sqlmock.NewResult(1, 1))
+	userID, err := d.ResetPassword("hash", []byte("new password"))
 
-	err = d.HandlePasswordMigration(&user, &credentials)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
 
+func TestResetPasswordInvalidToken(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
 	if err != nil {
-		t.Fatalf("Error was not expected migrating passwords: %s", err)
-	} else {
-		t.Log("Password migrated")
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
 	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT UserId FROM board.password_reset").
+		WithArgs("expired").
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}))
+	mock.ExpectRollback()
+
+	_, err = d.ResetPassword("expired", []byte("new password"))
+
+	assert.Equal(t, ErrInvalidResetToken, err)
 
 	if err = mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("User was not updated: %s", err)
-	} else {
-		t.Log("User updated")
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
-func TestHandleDatabaseMigrationMd5DoesntMatch(t *testing.T) {
+func TestRotateRefreshToken(t *testing.T) {
 	d := Database{}
+	var mock sqlmock.Sqlmock
 	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
 
-	user := model.User{
-		Username: "hi",
-		UserPasswordMd5: sql.NullString{
-			String: "E10ADC3949BA59ABBE56E057F20F883E", // "123456"
-			Valid:  true,
-		},
-		Password: nil,
-		ID:       "1",
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT UserId, RevokedAt IS NOT NULL, ExpiresAt <= now\\(\\) FROM board.refresh_token").
+		WithArgs("old").
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "revoked", "expired"}).AddRow("1", false, false))
+	mock.ExpectExec("UPDATE board.refresh_token SET RevokedAt").
+		WithArgs("old").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO board.refresh_token").
+		WithArgs("1", "new", 3600).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	userID, err := d.RotateRefreshToken("old", "new", time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
+}
 
-	credentials := model.Credentials{
-		Username: "hi",
-		Password: "123",
+func TestRotateRefreshTokenReused(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT UserId, RevokedAt IS NOT NULL, ExpiresAt <= now\\(\\) FROM board.refresh_token").
+		WithArgs("old").
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "revoked", "expired"}).AddRow("1", true, false))
+	mock.ExpectExec("UPDATE board.refresh_token SET RevokedAt").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectCommit()
+
+	userID, err := d.RotateRefreshToken("old", "new", time.Hour)
+
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	assert.Equal(t, "1", userID)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
+}
 
-	err = d.HandlePasswordMigration(&user, &credentials)
+func TestRotateRefreshTokenExpired(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
 
-	if err != nil && err == ErrWrongPassword {
-		t.Log("MD5 hashes do not match")
-	} else {
-		t.Fatal("MD5 hashes match")
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT UserId, RevokedAt IS NOT NULL, ExpiresAt <= now\\(\\) FROM board.refresh_token").
+		WithArgs("old").
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "revoked", "expired"}).AddRow("1", false, true))
+	mock.ExpectRollback()
+
+	_, err = d.RotateRefreshToken("old", "new", time.Hour)
+
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
-func TestHandleDatabaseMigrationMd5DoesntExist(t *testing.T) {
+func TestEnqueueEmail(t *testing.T) {
 	d := Database{}
+	var mock sqlmock.Sqlmock
 	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
 
-	user := model.User{
-		Username:        "hi",
-		UserPasswordMd5: sql.NullString{},
-		Password:        nil,
-		ID:              "1",
+	email := model.OutboxEmail{
+		Template:      "new_user",
+		Recipient:     "hsimpson@springfield.org",
+		RecipientName: "CoolGuy420",
+		Subject:       "Welcome",
+		Data:          map[string]string{"BoardURLVerify": "https://host.com/confirm/1/2"},
 	}
 
-	credentials := model.Credentials{
-		Username: "hi",
-		Password: "123",
+	mock.ExpectQuery("INSERT INTO board.email_outbox").WithArgs(
+		email.Template,
+		email.Recipient,
+		email.RecipientName,
+		email.Subject,
+		[]byte(`{"BoardURLVerify":"https://host.com/confirm/1/2"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+
+	id, err := d.EnqueueEmail(&email)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", id)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestClaimOutboxEmails(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
 	}
+	defer DB.Close()
 
-	err = d.HandlePasswordMigration(&user, &credentials)
+	rows := sqlmock.NewRows([]string{"id", "template", "recipient", "recipientname", "subject", "data", "status",
+		"attempts", "lasterror", "nextattemptat", "createdat", "sentat"}).
+		AddRow("1", "new_user", "hsimpson@springfield.org", "CoolGuy420", "Welcome", []byte(`{"DonateURL":"https://host.com/donate"}`),
+			"pending", 1, "", "A time", "A time", nil)
+
+	mock.ExpectQuery("UPDATE board.email_outbox").
+		WithArgs(20, 300, constants.EmailPending).
+		WillReturnRows(rows)
+
+	emails, err := d.ClaimOutboxEmails(20, 5*time.Minute)
+
+	expected := []model.OutboxEmail{{
+		Id:            "1",
+		Template:      "new_user",
+		Recipient:     "hsimpson@springfield.org",
+		RecipientName: "CoolGuy420",
+		Subject:       "Welcome",
+		Data:          map[string]string{"DonateURL": "https://host.com/donate"},
+		Status:        "pending",
+		Attempts:      1,
+		NextAttemptAt: "A time",
+		CreatedAt:     "A time",
+	}}
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, emails)
 
-	if err != nil && err == ErrWrongPassword {
-		t.Log("MD5 hashes do not match")
-	} else {
-		t.Fatal("MD5 hashes match")
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
 
-type AnyByte struct{}
+func TestMarkEmailSentClearsData(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
 
-// Match satisfies sqlmock.Argument interface
-func (a AnyByte) Match(v driver.Value) bool {
-	_, ok := v.([]byte)
-	return ok
+	mock.ExpectExec("UPDATE board.email_outbox SET (.+) Data = '{}'").
+		WithArgs(constants.EmailSent, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = d.MarkEmailSent("1")
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkEmailFailedDeadClearsData(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.email_outbox SET (.+) Data = CASE WHEN").
+		WithArgs(constants.EmailDead, "Mailbox full", 60, "1", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = d.MarkEmailFailed("1", "Mailbox full", time.Minute, true)
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRetryEmailNotDead(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.email_outbox").
+		WithArgs(constants.EmailPending, "1", constants.EmailDead).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = d.RetryEmail("1")
+
+	assert.Equal(t, ErrNoEmail, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestConfirmUserExpired(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.user").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS (.+) FROM board.user").
+		WithArgs("FakeID", "FakeCode", constants.NeedsConfirmation).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	valid, err := d.ConfirmUser("FakeID", "FakeCode")
+
+	assert.False(t, valid)
+	assert.Equal(t, ErrConfirmCodeExpired, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRenewConfirmCodeThrottled(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.user").
+		WithArgs(sqlmock.AnyArg(), int(confirmCodeLifetime.Seconds()), "FakeID", constants.NeedsConfirmation, 300).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = d.RenewConfirmCode("FakeID", 5*time.Minute)
+
+	assert.Equal(t, ErrConfirmThrottled, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleDatabaseMigrationMd5Exists(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	user := model.User{
+		Username: "hi",
+		UserPasswordMd5: sql.NullString{
+			String: "E10ADC3949BA59ABBE56E057F20F883E", // "123456"
+			Valid:  true,
+		},
+		Password: nil,
+		ID:       "1",
+	}
+
+	credentials := model.Credentials{
+		Username: "hi",
+		Password: "123456",
+	}
+
+	user.HashPassword(credentials.Password)
+
+	mock.ExpectExec(`UPDATE board.user`).WithArgs(
+		AnyByte{},
+		sql.NullString{},
+		"1").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = d.HandlePasswordMigration(&user, &credentials)
+
+	if err != nil {
+		t.Fatalf("Error was not expected migrating passwords: %s", err)
+	} else {
+		t.Log("Password migrated")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("User was not updated: %s", err)
+	} else {
+		t.Log("User updated")
+	}
+}
+
+func TestHandleDatabaseMigrationMd5DoesntMatch(t *testing.T) {
+	d := Database{}
+	var err error
+
+	user := model.User{
+		Username: "hi",
+		UserPasswordMd5: sql.NullString{
+			String: "E10ADC3949BA59ABBE56E057F20F883E", // "123456"
+			Valid:  true,
+		},
+		Password: nil,
+		ID:       "1",
+	}
+
+	credentials := model.Credentials{
+		Username: "hi",
+		Password: "123",
+	}
+
+	err = d.HandlePasswordMigration(&user, &credentials)
+
+	if err != nil && err == ErrWrongPassword {
+		t.Log("MD5 hashes do not match")
+	} else {
+		t.Fatal("MD5 hashes match")
+	}
+}
+
+func TestGetThreadSummary(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "title", "userid", "username", "categoryid", "requiredrole",
+		"postedat", "lastpostedat", "replycount", "lastposterid", "lastpostername"}).
+		AddRow("1", "Woof", "2", "hsimpson", "3", 3, "2019-01-01", "2019-01-02", 4, "5", "bsimpson")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread bt").
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	summary, err := d.GetThreadSummary("1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, summary.ReplyCount)
+	assert.Equal(t, "bsimpson", summary.LastPosterName)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetThreadSummaryNoPosts(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "title", "userid", "username", "categoryid", "requiredrole",
+		"postedat", "lastpostedat", "replycount", "lastposterid", "lastpostername"}).
+		AddRow("1", "Woof", "2", "hsimpson", "3", 3, "2019-01-01", "2019-01-02", 0, "", "")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread bt (.+) LEFT JOIN LATERAL").
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	summary, err := d.GetThreadSummary("1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", summary.Id)
+	assert.Equal(t, 0, summary.ReplyCount)
+	assert.Equal(t, "", summary.LastPosterId)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetThreadSummaryNoThread(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM board.thread bt").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = d.GetThreadSummary("1")
+
+	assert.Equal(t, ErrNoThread, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAppendEvent(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	event := model.Event{
+		Version:    1,
+		Type:       "post.created",
+		Id:         "1",
+		Topic:      "thread:2",
+		OccurredAt: time.Now(),
+		Payload:    model.Post{Id: "3", Body: "Woof"},
+	}
+
+	eventLogPrunedAt = 0
+
+	mock.ExpectQuery("INSERT INTO board.event_log").
+		WithArgs("1", 1, "thread:2", "post.created", AnyByte{}, event.OccurredAt).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(10103))
+	mock.ExpectExec("DELETE FROM board.event_log").
+		WithArgs(100).
+		WillReturnResult(sqlmock.NewResult(0, 100))
+
+	err = d.AppendEvent(&event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10103), event.Seq)
+
+	// Nothing is pruned until the sequence crosses the next hundred, even if it skips over it
+	mock.ExpectQuery("INSERT INTO board.event_log").
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(10150))
+	mock.ExpectQuery("INSERT INTO board.event_log").
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(10201))
+	mock.ExpectExec("DELETE FROM board.event_log").
+		WithArgs(200).
+		WillReturnResult(sqlmock.NewResult(0, 100))
+
+	assert.Nil(t, d.AppendEvent(&event))
+	assert.Nil(t, d.AppendEvent(&event))
+	assert.Equal(t, int64(10201), event.Seq)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetEventsSince(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	occurredAt := time.Now()
+	rows := sqlmock.NewRows([]string{"seq", "id", "version", "topic", "type", "payload", "occurredat"}).
+		AddRow(6, "1", 1, "thread:2", "post.created", []byte(`{"Id":"3"}`), occurredAt)
+
+	mock.ExpectQuery("SELECT Seq, Id, Version, Topic, Type, Payload, OccurredAt FROM board.event_log").
+		WithArgs(5, sqlmock.AnyArg(), 100).
+		WillReturnRows(rows)
+
+	events, err := d.GetEventsSince(5, []string{"thread:2", "threads-index"}, 100)
+
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, int64(6), events[0].Seq)
+	assert.Equal(t, json.RawMessage(`{"Id":"3"}`), events[0].Payload)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleDatabaseMigrationMd5DoesntExist(t *testing.T) {
+	d := Database{}
+	var err error
+
+	user := model.User{
+		Username:        "hi",
+		UserPasswordMd5: sql.NullString{},
+		Password:        nil,
+		ID:              "1",
+	}
+
+	credentials := model.Credentials{
+		Username: "hi",
+		Password: "123",
+	}
+
+	err = d.HandlePasswordMigration(&user, &credentials)
+
+	if err != nil && err == ErrWrongPassword {
+		t.Log("MD5 hashes do not match")
+	} else {
+		t.Fatal("MD5 hashes match")
+	}
+}
+
+type AnyByte struct{}
+
+// Match satisfies sqlmock.Argument interface
+func (a AnyByte) Match(v driver.Value) bool {
+	_, ok := v.([]byte)
+	return ok
+}
+
+func TestCreateNotification(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("INSERT INTO board.notification").
+		WithArgs("1", "reply", "2", "3", "", "Woof").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdat", "username"}).AddRow("4", "A time", "hsimpson"))
+
+	n := model.Notification{UserId: "1", Type: "reply", ActorId: "2", TargetId: "3", Text: "Woof"}
+	err = d.CreateNotification(&n)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "4", n.Id)
+	assert.Equal(t, "hsimpson", n.ActorName)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetNotifications(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "userid", "type", "actorid", "username", "targetid", "postid",
+		"text", "createdat", "readat"}).
+		AddRow("4", "1", "reply", "2", "hsimpson", "3", "5", "Woof", "A time", nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM board.notification bn").
+		WithArgs("1", true, 50).
+		WillReturnRows(rows)
+
+	notifications, err := d.GetNotifications("1", true, 50)
+
+	assert.Nil(t, err)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, "hsimpson", notifications[0].ActorName)
+	assert.Nil(t, notifications[0].ReadAt)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkNotificationReadNotFound(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.notification").
+		WithArgs("4", "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = d.MarkNotificationRead("1", "4")
+
+	assert.Equal(t, ErrNoNotification, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSavePostMentions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT Id, Username FROM board.user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).
+			AddRow("1", "hsimpson").
+			AddRow("2", "Marge"))
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM board.post_mention").
+		WithArgs("post").
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow("1"))
+	mock.ExpectExec("INSERT INTO board.post_mention").
+		WithArgs("post", "1", 0, 9).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO board.post_mention").
+		WithArgs("post", "2", 14, 20).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mentions, added, err := d.SavePostMentions("post", []model.Mention{
+		{UserName: "HSimpson", Start: 0, End: 9},
+		{UserName: "nobody", Start: 10, End: 13},
+		{UserName: "marge", Start: 14, End: 20},
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, mentions, 2)
+	assert.Equal(t, "hsimpson", mentions[0].UserName)
+	assert.Equal(t, "Marge", mentions[1].UserName)
+	assert.Equal(t, []string{"2"}, added)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPostMentions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM board.post_mention pm").
+		WillReturnRows(sqlmock.NewRows([]string{"postid", "userid", "username", "startoffset", "endoffset"}).
+			AddRow("a", "1", "hsimpson", 0, 9).
+			AddRow("a", "2", "marge", 14, 20))
+
+	mentions, err := d.GetPostMentions([]string{"a", "b"})
+
+	assert.Nil(t, err)
+	assert.Len(t, mentions["a"], 2)
+	assert.Empty(t, mentions["b"])
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateReportAlreadyReported(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("INSERT INTO board.report").
+		WithArgs("post", "1", "spam", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "createdat"}))
+
+	err = d.CreateReport(&model.Report{PostId: "post", ReporterId: "1", Reason: "spam"})
+
+	assert.Equal(t, ErrAlreadyReported, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetReportQueue(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "postid", "reporterid", "reportername", "reason", "details", "status",
+		"createdat", "resolvedby", "resolvedbyname", "resolvedat", "resolution",
+		"threadid", "userid", "username", "body", "postedat"}).
+		AddRow("1", "b", "2", "marge", "spam", "", "open", "3", "", "", nil, "", "t", "4", "bart", "Buy now", "1").
+		AddRow("2", "a", "2", "marge", "other", "", "open", "2", "", "", nil, "", "t", "4", "bart", "Hi", "1").
+		AddRow("3", "b", "5", "lisa", "spam", "", "open", "1", "", "", nil, "", "t", "4", "bart", "Buy now", "1")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.report br").
+		WithArgs("open", "", 50).
+		WillReturnRows(rows)
+
+	queue, err := d.GetReportQueue("open", "", 50)
+
+	assert.Nil(t, err)
+	assert.Len(t, queue, 2)
+	assert.Equal(t, "b", queue[0].Post.Id)
+	assert.Equal(t, "Buy now", queue[0].Post.Body)
+	assert.Len(t, queue[0].Reports, 2)
+	assert.Equal(t, "a", queue[1].Post.Id)
+	assert.Len(t, queue[1].Reports, 1)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestResolveReportsNoneOpen(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.report").
+		WithArgs(constants.ReportDismissed, "dismiss", "mod", "post", constants.ReportOpen).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = d.ResolveReports("post", "mod", constants.ReportDismissed, "dismiss")
+
+	assert.Equal(t, ErrNoReport, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAppendModLog(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("INSERT INTO board.mod_log").
+		WithArgs("mod", "thread.delete", "thread", "1", "Spam", []byte(`{"Id":"1"}`), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdat"}).AddRow("2", "A time"))
+
+	entry := model.ModLogEntry{
+		ActorId:    "mod",
+		Action:     "thread.delete",
+		TargetType: "thread",
+		TargetId:   "1",
+		Reason:     "Spam",
+		Before:     map[string]string{"Id": "1"},
+	}
+	err = d.AppendModLog(&entry)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2", entry.Id)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetModLog(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "actorid", "username", "action", "targettype", "targetid",
+		"targetrequiredrole", "reason", "before", "after", "createdat"}).
+		AddRow("2", "mod", "ned", "thread.delete", "thread", "1", 2, "Spam", []byte(`{"Id":"1"}`), nil, "A time")
+
+	mock.ExpectQuery("SELECT (.+) FROM board.mod_log ml").
+		WithArgs("thread.delete", "", "", "", 100, constants.User).
+		WillReturnRows(rows)
+
+	entries, err := d.GetModLog(model.ModLogFilter{Action: "thread.delete", Limit: 100})
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "ned", entries[0].ActorName)
+	assert.Equal(t, int(constants.Elite), entries[0].TargetRequiredRole)
+	assert.Equal(t, json.RawMessage(`{"Id":"1"}`), entries[0].Before)
+	assert.Nil(t, entries[0].After)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreThreadNotDeleted(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectExec("UPDATE board.thread SET Deleted = false").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = d.RestoreThread("1")
+
+	assert.Equal(t, ErrNoThread, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+var sanctionRowColumns = []string{"id", "userid", "type", "reason", "issuedby", "issuedbyname", "startsat", "endsat",
+	"createdat", "liftedat", "liftedby"}
+
+func TestCreateSanction(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("INSERT INTO board.sanction").
+		WithArgs("1", "mute", "Spam", "2", int64(86400)).
+		WillReturnRows(sqlmock.NewRows(sanctionRowColumns).
+			AddRow("3", "1", "mute", "Spam", "2", "mod", "2026-10-17", "2026-10-18", "2026-10-17", nil, ""))
+
+	s := model.Sanction{UserId: "1", Type: "mute", Reason: "Spam", IssuedBy: "2"}
+	err = d.CreateSanction(&s, 24*time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "3", s.Id)
+	assert.Equal(t, "mod", s.IssuedByName)
+	assert.Equal(t, "2026-10-18", *s.EndsAt)
+	assert.Nil(t, s.LiftedAt)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetActiveSanctions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM board.sanction WHERE UserId = (.+) AND LiftedAt IS NULL").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows(sanctionRowColumns).
+			AddRow("3", "1", "ban", "", "2", "mod", "2026-10-17", nil, "2026-10-17", nil, ""))
+
+	sanctions, err := d.GetActiveSanctions("1")
+
+	assert.Nil(t, err)
+	assert.Len(t, sanctions, 1)
+	assert.Equal(t, "ban", sanctions[0].Type)
+	assert.Nil(t, sanctions[0].EndsAt)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLiftSanction(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("UPDATE board.sanction").
+		WithArgs("2", "3").
+		WillReturnRows(sqlmock.NewRows(sanctionRowColumns).
+			AddRow("3", "1", "mute", "", "2", "mod", "2026-10-17", nil, "2026-10-17", "2026-10-17", "2"))
+
+	s, err := d.LiftSanction("3", "2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2", s.LiftedBy)
+	assert.Equal(t, "2026-10-17", *s.LiftedAt)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLiftSanctionNotFound(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("UPDATE board.sanction").
+		WithArgs("2", "3").
+		WillReturnRows(sqlmock.NewRows(sanctionRowColumns))
+
+	_, err = d.LiftSanction("3", "2")
+
+	assert.Equal(t, ErrNoSanction, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExpireSanctions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("UPDATE board.sanction SET LiftedAt = EndsAt").
+		WillReturnRows(sqlmock.NewRows(sanctionRowColumns).
+			AddRow("3", "1", "mute", "", "2", "mod", "2026-10-16", "2026-10-17", "2026-10-16", "2026-10-17", ""))
+
+	sanctions, err := d.ExpireSanctions()
+
+	assert.Nil(t, err)
+	assert.Len(t, sanctions, 1)
+	assert.Equal(t, "1", sanctions[0].UserId)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs(constants.Elite, constants.PermThreadDelete, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"allowed"}).AddRow(true))
+
+	allowed, err := d.HasPermission(constants.Elite, constants.PermThreadDelete, "5")
+
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetRolePermissions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT Role, array_agg(.+) FROM board.role_permission").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "permissions"}).
+			AddRow(int(constants.Mod), "{post.delete,thread.delete}"))
+
+	roles, err := d.GetRolePermissions()
+
+	assert.Nil(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, "Mod", roles[0].RoleName)
+	assert.Equal(t, []string{"post.delete", "thread.delete"}, roles[0].Permissions)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetRolePermissions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM board.role_permission").
+		WithArgs(constants.Elite).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO board.role_permission").
+		WithArgs(constants.Elite, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = d.SetRolePermissions(constants.Elite, []string{"post.delete"})
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetCategoryPermissions(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM board.category_permission").
+		WithArgs("5").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO board.category_permission").
+		WithArgs("5", int(constants.Mod), "thread.delete", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = d.SetCategoryPermissions("5", []model.CategoryPermission{
+		{Role: int(constants.Mod), Permission: "thread.delete", Allowed: false},
+	})
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPostCategoryIDNotFound(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectQuery("SELECT bt.CategoryId FROM board.thread_post").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"categoryid"}))
+
+	_, err = d.GetPostCategoryID("1")
+
+	assert.Equal(t, ErrNoPost, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT Id FROM board.user WHERE UserRole = (.+) FOR UPDATE").
+		WithArgs(constants.Admin).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+	mock.ExpectQuery("SELECT UserRole FROM board.user WHERE Id = (.+) FOR UPDATE").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"userrole"}).AddRow(int(constants.User)))
+	mock.ExpectExec("UPDATE board.user SET UserRole").
+		WithArgs(constants.Elite, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = d.SetUserRole("1", constants.Elite)
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRoleDemotesAdmin(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT Id FROM board.user WHERE UserRole = (.+) FOR UPDATE").
+		WithArgs(constants.Admin).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+	mock.ExpectQuery("SELECT UserRole FROM board.user WHERE Id = (.+) FOR UPDATE").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"userrole"}).AddRow(int(constants.Admin)))
+	mock.ExpectExec("UPDATE board.user SET UserRole").
+		WithArgs(constants.User, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = d.SetUserRole("1", constants.User)
+
+	assert.Nil(t, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRoleLastAdmin(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT Id FROM board.user WHERE UserRole = (.+) FOR UPDATE").
+		WithArgs(constants.Admin).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	mock.ExpectQuery("SELECT UserRole FROM board.user WHERE Id = (.+) FOR UPDATE").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"userrole"}).AddRow(int(constants.Admin)))
+	mock.ExpectRollback()
+
+	err = d.SetUserRole("1", constants.User)
+
+	assert.Equal(t, ErrLastAdmin, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRoleNoUser(t *testing.T) {
+	d := Database{}
+	var mock sqlmock.Sqlmock
+	var err error
+	DB, mock, err = sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error %s occurred when opening stub database connection", err)
+	}
+	defer DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT Id FROM board.user WHERE UserRole = (.+) FOR UPDATE").
+		WithArgs(constants.Admin).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+	mock.ExpectQuery("SELECT UserRole FROM board.user WHERE Id = (.+) FOR UPDATE").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"userrole"}))
+	mock.ExpectRollback()
+
+	err = d.SetUserRole("1", constants.User)
+
+	assert.Equal(t, ErrNoUser, err)
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
 }
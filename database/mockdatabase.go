@@ -18,10 +18,12 @@ func (m *MockDatabase) GetThread(threadId string) (model.Thread, error) {
 	return result, nil
 }
 
-func (m *MockDatabase) GetPosts(threadId string) ([]model.Post, error) {
-	result := []model.Post{
-		{Id: "", ThreadId: "", UserId: "", Body: "Post Body", PostedAt: "A time" },
-		{Id: "", ThreadId: "", UserId: "", Body: "Post Body 2", PostedAt: "A time" },
+func (m *MockDatabase) GetPosts(threadId string, page model.PostPageRequest) (model.PostPage, error) {
+	result := model.PostPage{
+		Posts: []model.Post{
+			{Id: "", ThreadId: "", UserId: "", Body: "Post Body", PostedAt: "A time" },
+			{Id: "", ThreadId: "", UserId: "", Body: "Post Body 2", PostedAt: "A time" },
+		},
 	}
 
 	return result, nil
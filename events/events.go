@@ -0,0 +1,143 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/broker"
+	"github.com/DarthHater/bored-board-service/model"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Version is bumped whenever the envelope or a payload changes in a way clients have to handle.
+const Version = 1
+
+// Type says what happened, so clients don't have to guess from the shape of the payload.
+type Type string
+
+const (
+	PostCreated         Type = "post.created"
+	PostEdited          Type = "post.edited"
+	PostDeleted         Type = "post.deleted"
+	ThreadCreated       Type = "thread.created"
+	ThreadBumped        Type = "thread.bumped"
+	ThreadDeleted       Type = "thread.deleted"
+	MessageCreated      Type = "message.created"
+	MessagePostCreated  Type = "message_post.created"
+	UserRoleChanged     Type = "user.role_changed"
+	UserSanctioned      Type = "user.sanctioned"
+	UserSanctionLifted  Type = "user.sanction_lifted"
+	UserSignedOut       Type = "user.signed_out"
+	UserTyping          Type = "user.typing"
+	NotificationCreated Type = "notification.created"
+	PresenceJoined      Type = "presence.joined"
+	PresenceLeft        Type = "presence.left"
+)
+
+// Clients subscribe to topics to receive events. Topics are also the names of the channels events are
+// published on.
+const (
+	ThreadsIndexTopic  = "threads-index"
+	PresenceTopic      = "presence"
+	ThreadTopicPrefix  = "thread:"
+	MessageTopicPrefix = "message:"
+	UserTopicPrefix    = "user:"
+)
+
+// ThreadTopic is where events about the posts in a thread are published.
+func ThreadTopic(threadID string) string {
+	return ThreadTopicPrefix + threadID
+}
+
+// MessageTopic is where events about the posts in a private message are published.
+func MessageTopic(messageID string) string {
+	return MessageTopicPrefix + messageID
+}
+
+// UserTopic is where events only meant for one user are published.
+func UserTopic(userID string) string {
+	return UserTopicPrefix + userID
+}
+
+// New wraps a payload in an event envelope.
+func New(topic string, eventType Type, payload interface{}) model.Event {
+	return model.Event{
+		Version:    Version,
+		Type:       string(eventType),
+		Id:         uuid.NewV4().String(),
+		Topic:      topic,
+		OccurredAt: time.Now().UTC(),
+		Payload:    payload,
+	}
+}
+
+// RoleChange is the payload of a user.role_changed event.
+type RoleChange struct {
+	UserId string
+	Role   int
+}
+
+// SignOut is the payload of a user.signed_out event.
+type SignOut struct {
+	UserId string
+}
+
+// Typing is the payload of a user.typing event.
+type Typing struct {
+	UserId   string
+	UserName string
+	Topic    string
+}
+
+// Deleted is the payload of events about something that no longer exists.
+type Deleted struct {
+	Id string
+}
+
+// Publisher sends events to every server, which pass them on to the clients subscribed to the topic.
+type Publisher interface {
+	Publish(topic string, eventType Type, payload interface{}) error
+	// PublishEphemeral publishes an event that isn't worth replaying, like someone typing.
+	PublishEphemeral(topic string, eventType Type, payload interface{}) error
+}
+
+// Log keeps recent events, so clients that reconnect can catch up on the ones they missed.
+type Log interface {
+	AppendEvent(e *model.Event) error
+}
+
+// BrokerPublisher publishes events through a broker on topics named after their topic, after adding
+// them to the event log when there is one.
+type BrokerPublisher struct {
+	Broker broker.Broker
+	Log    Log
+}
+
+// Publish wraps the payload in an event envelope and publishes it to the topic.
+func (p *BrokerPublisher) Publish(topic string, eventType Type, payload interface{}) error {
+	event := New(topic, eventType, payload)
+	if p.Log != nil {
+		// An event that can't be logged can still be delivered live, it just can't be replayed
+		if err := p.Log.AppendEvent(&event); err != nil {
+			log.WithFields(log.Fields{"topic": topic, "type": eventType}).Error(err)
+		}
+	}
+
+	return p.send(event)
+}
+
+// PublishEphemeral wraps the payload in an event envelope and publishes it to the topic without adding
+// it to the event log.
+func (p *BrokerPublisher) PublishEphemeral(topic string, eventType Type, payload interface{}) error {
+	return p.send(New(topic, eventType, payload))
+}
+
+func (p *BrokerPublisher) send(event model.Event) error {
+	bytes, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	return p.Broker.Publish(event.Topic, bytes)
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/broker"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	post := model.Post{Id: "1", ThreadId: "2", Body: "Woof"}
+
+	event := New(ThreadTopic("2"), PostCreated, post)
+
+	assert.Equal(t, Version, event.Version)
+	assert.Equal(t, "thread:2", event.Topic)
+	assert.NotEmpty(t, event.Id)
+	assert.False(t, event.OccurredAt.IsZero())
+
+	bytes, err := json.Marshal(event)
+	assert.Nil(t, err)
+
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(bytes, &decoded))
+	assert.Equal(t, "post.created", decoded["type"])
+	assert.Equal(t, "Woof", decoded["payload"].(map[string]interface{})["Body"])
+}
+
+func TestBrokerPublisher(t *testing.T) {
+	b := broker.NewMemoryBroker()
+	defer b.Close()
+
+	received := make(chan broker.Message, 1)
+	go b.Subscribe([]string{"thread:*"}, func(m broker.Message) {
+		received <- m
+	})
+
+	p := &BrokerPublisher{Broker: b}
+	post := model.Post{Id: "1", ThreadId: "2", Body: "Woof"}
+
+	// The subscription may not be registered yet, so keep publishing until something arrives
+	var message broker.Message
+	for message.Topic == "" {
+		assert.Nil(t, p.Publish(ThreadTopic("2"), PostCreated, post))
+		select {
+		case message = <-received:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var event model.Event
+	assert.Nil(t, json.Unmarshal(message.Data, &event))
+	assert.Equal(t, "thread:2", message.Topic)
+	assert.Equal(t, "post.created", event.Type)
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// FileMailer writes each email to a .eml file in a directory instead of sending it, which is handy in
+// development and tests.
+type FileMailer struct {
+	Directory string
+}
+
+// Send will write the message to a new file in the mailer's directory.
+func (f *FileMailer) Send(m *Message) error {
+	if err := os.MkdirAll(f.Directory, 0755); err != nil {
+		return err
+	}
+
+	body, err := m.MIME()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewV4().String())
+
+	return ioutil.WriteFile(filepath.Join(f.Directory, name), body, 0644)
+}
@@ -0,0 +1,19 @@
+package mail
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// LogMailer only logs emails rather than sending them.
+type LogMailer struct {
+}
+
+// Send will log the message.
+func (l *LogMailer) Send(m *Message) error {
+	log.WithFields(log.Fields{
+		"to":      m.ToAddress,
+		"subject": m.Subject,
+	}).Info(m.Text)
+
+	return nil
+}
@@ -14,17 +14,31 @@ limitations under the License. */
 package mail
 
 import (
+	"errors"
+	"strconv"
+	"time"
+
 	"github.com/DarthHater/bored-board-service/constants"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-	"strconv"
-	"time"
 )
 
+// ErrUnknownTemplate occurs when trying to send an email that doesn't have a template
+var ErrUnknownTemplate = errors.New("Unknown email template")
+
+var mailer Mailer
+
 func init() {
 	setupViper()
+
+	m, err := NewMailer(viper.GetString(constants.MailerEnvVariable))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"mailer": viper.GetString(constants.MailerEnvVariable),
+		}).Error("Unknown mailer, emails will only be logged")
+		m = &LogMailer{}
+	}
+	SetMailer(m)
 }
 
 func setupViper() {
@@ -33,61 +47,62 @@ func setupViper() {
 	}).Debug("Setting up Viper")
 
 	viper.SetEnvPrefix(constants.EnvironmentVariablePrefix)
-	viper.BindEnv(constants.RegistrationEmailEnvVariable)
+	viper.SetDefault(constants.MailerEnvVariable, "sendgrid")
+	viper.SetDefault(constants.SMTPPortEnvVariable, 25)
+	viper.SetDefault(constants.MailDirectoryEnvVariable, "./.mail")
+	viper.BindEnv(constants.MailerEnvVariable)
 	viper.BindEnv(constants.SendGridAPIKeyEnvVariable)
+	viper.BindEnv(constants.SMTPHostEnvVariable)
+	viper.BindEnv(constants.SMTPPortEnvVariable)
+	viper.BindEnv(constants.SMTPUsernameEnvVariable)
+	viper.BindEnv(constants.SMTPPasswordEnvVariable)
+	viper.BindEnv(constants.MailDirectoryEnvVariable)
 	viper.BindEnv(constants.EmailFromAddressEnvVariable)
 	viper.BindEnv(constants.EmailFromNameEnvVariable)
 }
 
-// SendNewUserEmail function to send a new user registration email
-func SendNewUserEmail(recipient string, subject string, userName string, boardURLVerify string, donateURL string) {
-	m := mail.NewV3Mail()
-	m.Subject = subject
-	p := mail.NewPersonalization()
-
-	to := mail.NewEmail(userName, recipient)
-	log.WithFields(log.Fields{
-		"emailFromName":    viper.GetString(constants.EmailFromNameEnvVariable),
-		"emailFromAddress": viper.GetString(constants.EmailFromAddressEnvVariable),
-	}).Info("Attempting to send New User email")
-	p.AddTos(to)
-
-	from := mail.NewEmail(
-		viper.GetString(constants.EmailFromNameEnvVariable),
-		viper.GetString(constants.EmailFromAddressEnvVariable),
-	)
-	m.SetFrom(from)
-
-	m.SetTemplateID(viper.GetString(constants.RegistrationEmailEnvVariable))
-
-	t := time.Now()
+// SetMailer replaces the mailer used to send emails.
+func SetMailer(m Mailer) {
+	mailer = m
+}
 
-	p.SetDynamicTemplateData("userName", userName)
-	p.SetDynamicTemplateData("boardURLVerify", boardURLVerify)
-	p.SetDynamicTemplateData("donateURL", donateURL)
-	p.SetDynamicTemplateData("year", strconv.Itoa(t.Year()))
+// Send renders the named template with the given data and sends it to the recipient. The recipient's
+// name is available to templates as UserName.
+func Send(templateName string, recipient string, userName string, subject string, data map[string]string) error {
+	t, ok := templates[templateName]
+	if !ok {
+		return ErrUnknownTemplate
+	}
 
-	m.AddPersonalizations(p)
+	values := map[string]string{
+		"UserName": userName,
+		"Year":     strconv.Itoa(time.Now().Year()),
+	}
+	for k, v := range data {
+		values[k] = v
+	}
 
-	request := sendgrid.GetRequest(
-		viper.GetString(constants.SendGridAPIKeyEnvVariable),
-		constants.SendgridSendMailAPIPathV3,
-		constants.SendGridAPIBasePath,
-	)
-	request.Method = "POST"
-	request.Body = mail.GetRequestBody(m)
+	html, text, err := t.render(values)
+	if err != nil {
+		return err
+	}
 
-	response, err := sendgrid.API(request)
+	err = mailer.Send(&Message{
+		ToName:      userName,
+		ToAddress:   recipient,
+		FromName:    viper.GetString(constants.EmailFromNameEnvVariable),
+		FromAddress: viper.GetString(constants.EmailFromAddressEnvVariable),
+		Subject:     subject,
+		Text:        text,
+		HTML:        html,
+	})
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error":     err,
-			"userName":  userName,
-			"recipient": recipient,
-		}).Error("Error sending New User Registration email")
-	} else {
-		log.WithFields(log.Fields{
-			"responseCode": response.StatusCode,
-			"userName":     userName,
-		}).Info("New User Registration Email sent successfully")
+		return err
 	}
+
+	log.WithFields(log.Fields{
+		"template": templateName,
+		"userName": userName,
+	}).Info("Email sent successfully")
+	return nil
 }
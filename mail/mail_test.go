@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMailer struct {
+	sent []*Message
+}
+
+func (r *recordingMailer) Send(m *Message) error {
+	r.sent = append(r.sent, m)
+	return nil
+}
+
+func TestSendNewUserEmail(t *testing.T) {
+	r := &recordingMailer{}
+	SetMailer(r)
+
+	err := Send(NewUserTemplate, "hsimpson@springfield.org", "<Homer>", "Welcome", map[string]string{
+		"BoardURLVerify": "https://host.com/confirm/1/2",
+		"DonateURL":      "https://host.com/donate",
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, r.sent, 1)
+	assert.Equal(t, "hsimpson@springfield.org", r.sent[0].ToAddress)
+	assert.Equal(t, "Welcome", r.sent[0].Subject)
+	assert.Contains(t, r.sent[0].Text, "https://host.com/confirm/1/2")
+	assert.Contains(t, r.sent[0].Text, "Hey <Homer>")
+	assert.Contains(t, r.sent[0].HTML, `href="https://host.com/confirm/1/2"`)
+	assert.Contains(t, r.sent[0].HTML, "Hey &lt;Homer&gt;")
+}
+
+func TestSendUnknownTemplate(t *testing.T) {
+	SetMailer(&recordingMailer{})
+
+	err := Send("nope", "hsimpson@springfield.org", "Homer", "Hi", nil)
+
+	assert.Equal(t, ErrUnknownTemplate, err)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := &FileMailer{Directory: dir}
+	err = f.Send(&Message{ToAddress: "hsimpson@springfield.org", FromAddress: "no_reply@host.com", Subject: "Hi", Text: "Text body", HTML: "<p>HTML body</p>"})
+	assert.Nil(t, err)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), ".eml"))
+
+	contents, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+	assert.Contains(t, string(contents), "To: <hsimpson@springfield.org>")
+	assert.Contains(t, string(contents), "Text body")
+	assert.Contains(t, string(contents), "<p>HTML body</p>")
+}
+
+func TestNewMailerUnknown(t *testing.T) {
+	_, err := NewMailer("carrier pigeon")
+	assert.Equal(t, ErrUnknownMailer, err)
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/spf13/viper"
+)
+
+// ErrUnknownMailer occurs when the configured mailer isn't one we know how to build
+var ErrUnknownMailer = errors.New("Unknown mailer")
+
+// Message is a rendered email, ready to be sent.
+type Message struct {
+	ToName      string
+	ToAddress   string
+	FromName    string
+	FromAddress string
+	Subject     string
+	Text        string
+	HTML        string
+}
+
+// Mailer defines an interface for sending rendered emails.
+type Mailer interface {
+	Send(m *Message) error
+}
+
+// NewMailer builds the mailer named by kind, which is one of sendgrid, smtp, file or log, using
+// settings from viper.
+func NewMailer(kind string) (Mailer, error) {
+	switch strings.ToLower(kind) {
+	case "sendgrid":
+		return &SendGridMailer{
+			APIKey: viper.GetString(constants.SendGridAPIKeyEnvVariable),
+		}, nil
+	case "smtp":
+		return &SMTPMailer{
+			Host:     viper.GetString(constants.SMTPHostEnvVariable),
+			Port:     viper.GetInt(constants.SMTPPortEnvVariable),
+			Username: viper.GetString(constants.SMTPUsernameEnvVariable),
+			Password: viper.GetString(constants.SMTPPasswordEnvVariable),
+		}, nil
+	case "file":
+		return &FileMailer{
+			Directory: viper.GetString(constants.MailDirectoryEnvVariable),
+		}, nil
+	case "log":
+		return &LogMailer{}, nil
+	}
+
+	return nil, ErrUnknownMailer
+}
@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"fmt"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGridMailer sends email through SendGrid's v3 API.
+type SendGridMailer struct {
+	APIKey string
+}
+
+// Send will send a message through SendGrid.
+func (s *SendGridMailer) Send(m *Message) error {
+	v3 := mail.NewV3MailInit(
+		mail.NewEmail(m.FromName, m.FromAddress),
+		m.Subject,
+		mail.NewEmail(m.ToName, m.ToAddress),
+		mail.NewContent("text/plain", m.Text),
+		mail.NewContent("text/html", m.HTML),
+	)
+
+	request := sendgrid.GetRequest(
+		s.APIKey,
+		constants.SendgridSendMailAPIPathV3,
+		constants.SendGridAPIBasePath,
+	)
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(v3)
+
+	response, err := sendgrid.API(request)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("SendGrid responded with status %d: %s", response.StatusCode, response.Body)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer sends email through a plain SMTP server.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// Send will send a message through the SMTP server, authenticating if a username is set.
+func (s *SMTPMailer) Send(m *Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	body, err := m.MIME()
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", s.Host, s.Port), auth, m.FromAddress, []string{m.ToAddress}, body)
+}
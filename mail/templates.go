@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+const htmlLayout = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<body style="font-family: Helvetica, Arial, sans-serif; color: #222;">
+{{template "content" .}}
+<p style="color: #888; font-size: 12px;">&copy; {{.Year}} Bored Board</p>
+</body>
+</html>{{end}}`
+
+const textLayout = `{{define "layout"}}{{template "content" .}}
+
+(c) {{.Year}} Bored Board
+{{end}}`
+
+const newUserHTML = `{{define "content"}}<p>Hey {{.UserName}},</p>
+<p>Thanks for registering for the Bored Board! Click the link below to confirm your account:</p>
+<p><a href="{{.BoardURLVerify}}">{{.BoardURLVerify}}</a></p>
+<p>Keeping the lights on costs money, so if you're feeling generous you can <a href="{{.DonateURL}}">donate here</a>.</p>{{end}}`
+
+const newUserText = `{{define "content"}}Hey {{.UserName}},
+
+Thanks for registering for the Bored Board! Visit the link below to confirm your account:
+
+{{.BoardURLVerify}}
+
+Keeping the lights on costs money, so if you're feeling generous you can donate at {{.DonateURL}}{{end}}`
+
+const passwordResetHTML = `{{define "content"}}<p>Hey {{.UserName}},</p>
+<p>Someone asked to reset the password for your Bored Board account. If it was you, click the link below to choose a new one:</p>
+<p><a href="{{.BoardURLReset}}">{{.BoardURLReset}}</a></p>
+<p>The link expires in an hour and can only be used once. If you didn't ask for this, you can ignore this email.</p>{{end}}`
+
+const passwordResetText = `{{define "content"}}Hey {{.UserName}},
+
+Someone asked to reset the password for your Bored Board account. If it was you, visit the link below to choose a new one:
+
+{{.BoardURLReset}}
+
+The link expires in an hour and can only be used once. If you didn't ask for this, you can ignore this email.{{end}}`
+
+// emailTemplate holds the HTML and plain text versions of an email.
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Names of the emails that can be sent.
+const (
+	NewUserTemplate       = "new_user"
+	PasswordResetTemplate = "password_reset"
+)
+
+var templates = map[string]emailTemplate{
+	NewUserTemplate:       newEmailTemplate(NewUserTemplate, newUserHTML, newUserText),
+	PasswordResetTemplate: newEmailTemplate(PasswordResetTemplate, passwordResetHTML, passwordResetText),
+}
+
+func newEmailTemplate(name string, html string, text string) emailTemplate {
+	return emailTemplate{
+		html: htmltemplate.Must(htmltemplate.Must(htmltemplate.New(name).Parse(htmlLayout)).Parse(html)),
+		text: texttemplate.Must(texttemplate.Must(texttemplate.New(name).Parse(textLayout)).Parse(text)),
+	}
+}
+
+// render executes both versions of the template with the given data.
+func (t emailTemplate) render(data interface{}) (html string, text string, err error) {
+	var h, p bytes.Buffer
+
+	if err = t.html.ExecuteTemplate(&h, "layout", data); err != nil {
+		return "", "", err
+	}
+
+	if err = t.text.ExecuteTemplate(&p, "layout", data); err != nil {
+		return "", "", err
+	}
+
+	return h.String(), p.String(), nil
+}
@@ -14,23 +14,32 @@ limitations under the License. */
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/DarthHater/bored-board-service/auth"
+	"github.com/DarthHater/bored-board-service/broker"
 	"github.com/DarthHater/bored-board-service/constants"
 	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/events"
 	"github.com/DarthHater/bored-board-service/mail"
+	"github.com/DarthHater/bored-board-service/mention"
 	"github.com/DarthHater/bored-board-service/model"
+	"github.com/DarthHater/bored-board-service/notify"
+	"github.com/DarthHater/bored-board-service/outbox"
+	"github.com/DarthHater/bored-board-service/policy"
+	"github.com/DarthHater/bored-board-service/presence"
+	"github.com/DarthHater/bored-board-service/sanction"
 	"github.com/garyburd/redigo/redis"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
-	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	ginlogrus "github.com/toorop/gin-logrus"
@@ -38,14 +47,22 @@ import (
 )
 
 const (
-	redisURL = "redis_db:6379"
+	redisURL              = "redis_db:6379"
+	defaultPostPageSize   = 50
+	maxPostPageSize       = 200
+	passwordResetExpiry   = time.Hour
+	passwordResetThrottle = 5 * time.Minute
+	confirmResendThrottle = 5 * time.Minute
 )
 
 var (
-	db          database.IDatabase
-	a           auth.IAuth
-	gPubSubConn *redis.PubSubConn
-	gRedisConn  = func() (redis.Conn, error) {
+	db            database.IDatabase
+	a             auth.IAuth
+	publisher     events.Publisher
+	messageBroker broker.Broker
+	tracker       *presence.Tracker
+	notifier      *notify.Notifier
+	gRedisConn    = func() (redis.Conn, error) {
 		redisURL := os.Getenv(constants.RedisURLEnvVariable)
 		if redisURL != "" {
 			return redis.DialURL(redisURL)
@@ -55,105 +72,34 @@ var (
 	}
 )
 
-type clientManager struct {
-	clients    map[*client]bool
-	broadcast  chan []byte
-	register   chan *client
-	unregister chan *client
-}
-
-type client struct {
-	id     string
-	socket *websocket.Conn
-	send   chan []byte
-}
-
-var manager = clientManager{
-	broadcast:  make(chan []byte),
-	register:   make(chan *client),
-	unregister: make(chan *client),
-	clients:    make(map[*client]bool),
-}
-
-func (manager *clientManager) start() {
-	for {
-		select {
-		case conn := <-manager.register:
-			manager.clients[conn] = true
-			log.Debug("New connection registered")
-		case conn := <-manager.unregister:
-			if _, ok := manager.clients[conn]; ok {
-				close(conn.send)
-				delete(manager.clients, conn)
-			}
-		case message := <-manager.broadcast:
-			for conn := range manager.clients {
-				select {
-				case conn.send <- message:
-				default:
-					close(conn.send)
-					delete(manager.clients, conn)
-				}
-			}
-		}
-	}
-}
+func init() {
+	setupViper()
 
-func (manager *clientManager) send(message []byte) {
-	for conn := range manager.clients {
-		conn.send <- message
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial:        gRedisConn,
 	}
-}
 
-func (c *client) read() {
-	defer func() {
-		manager.unregister <- c
-		c.socket.Close()
-	}()
-
-	for {
-		switch v := gPubSubConn.Receive().(type) {
-		case redis.Message:
-			manager.broadcast <- v.Data
-		case error:
-			manager.unregister <- c
-			c.socket.Close()
-			break
-		}
+	kind := viper.GetString(constants.BrokerEnvVariable)
+	b, err := broker.New(kind, pool)
+	if err != nil {
+		log.WithFields(log.Fields{"broker": kind}).Fatal(err)
 	}
-}
-
-func (c *client) write() {
-	defer func() {
-		c.socket.Close()
-	}()
-
-	for {
-		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.socket.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			c.socket.WriteMessage(websocket.TextMessage, message)
-		}
+	messageBroker = b
+	tracker = presence.NewTracker(messageBroker)
+	tracker.OnChange = broadcastPresence
+
+	// Without Redis there's only one server, so revocations only need to be kept in memory
+	var revocations auth.RevocationStore = auth.NewMemoryRevocationStore()
+	if kind == "redis" {
+		revocations = auth.NewRevocationStore(pool)
 	}
-}
-
-var webSocketUpgrade = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
 
-func init() {
-	au := auth.Auth{}
+	au := auth.Auth{Revocations: revocations}
 	a = &au
 
 	a.ReadAndSetKeys()
-	setupViper()
 }
 
 func setupViper() {
@@ -162,30 +108,30 @@ func setupViper() {
 	}).Debug("Setting up Viper")
 
 	viper.SetEnvPrefix(constants.EnvironmentVariablePrefix)
+	viper.SetDefault(constants.BrokerEnvVariable, "redis")
+	viper.BindEnv(constants.BrokerEnvVariable)
 	viper.BindEnv(constants.BoardURLVerifyEnvVariable)
 	viper.BindEnv(constants.BoardURLDonateEnvVariable)
 	viper.BindEnv(constants.BoardURLCorsEnvVariable)
 	viper.BindEnv(constants.BoardSendNewUserEmailSubject)
+	viper.BindEnv(constants.BoardURLResetEnvVariable)
+	viper.BindEnv(constants.BoardSendPasswordResetSubject)
 }
 
 func main() {
 	d := database.Database{}
 	db = &d
+	publisher = &events.BrokerPublisher{Broker: messageBroker, Log: db}
+	notifier = notify.NewNotifier(db, publisher)
 	r := setupRouter(db)
 	r.Use(gin.Logger())
 
-	gRedisConn, err := gRedisConn()
-	if err != nil {
-		panic(err)
-	}
-	defer gRedisConn.Close()
-
-	gPubSubConn = &redis.PubSubConn{Conn: gRedisConn}
-	gPubSubConn.Subscribe("posts")
-	gPubSubConn.Subscribe("message_posts")
-	defer gPubSubConn.Close()
-
 	go manager.start()
+	go manager.subscribe()
+	go tracker.Start()
+	go reloadKeysOnSignal()
+	go outbox.NewWorker(db).Start()
+	go sanction.NewWorker(db, sanctionLifted).Start()
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -195,6 +141,32 @@ func main() {
 	}
 }
 
+// publish sends an event to the clients subscribed to a topic. The request that caused it has already
+// succeeded, so failures are only logged.
+func publish(topic string, eventType events.Type, payload interface{}) {
+	if err := publisher.Publish(topic, eventType, payload); err != nil {
+		log.WithFields(log.Fields{
+			"topic": topic,
+			"type":  eventType,
+		}).Error(err)
+	}
+}
+
+// reloadKeysOnSignal reloads the JWT keys whenever the process gets a SIGHUP, so keys can be rotated
+// without a restart.
+func reloadKeysOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if err := a.ReloadKeys(); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Unable to reload JWT keys, keeping the current ones")
+		} else {
+			log.Info("Reloaded JWT keys")
+		}
+	}
+}
+
 func setupRouter(d database.IDatabase) *gin.Engine {
 	log := log.New()
 	r := gin.New()
@@ -227,10 +199,30 @@ func setupRouter(d database.IDatabase) *gin.Engine {
 		checkCredentials(c, d)
 	})
 
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.JWKS())
+	})
+
+	r.POST("/token/refresh", func(c *gin.Context) {
+		refreshToken(c, d)
+	})
+
 	r.POST("/register", func(c *gin.Context) {
 		createUser(c, d)
 	})
 
+	r.POST("/password/forgot", func(c *gin.Context) {
+		forgotPassword(c, d)
+	})
+
+	r.POST("/password/reset", func(c *gin.Context) {
+		resetPassword(c, d)
+	})
+
+	r.POST("/confirm/resend", func(c *gin.Context) {
+		resendConfirmation(c, d)
+	})
+
 	r.GET("/confirm/:userid/:confirmcode", func(c *gin.Context) {
 		userID := c.Param("userid")
 		confirmCode := c.Param("confirmcode")
@@ -241,10 +233,21 @@ func setupRouter(d database.IDatabase) *gin.Engine {
 		webSocketHandler(c.Writer, c.Request)
 	})
 
+	r.GET("/events", func(c *gin.Context) {
+		eventStreamHandler(c, d)
+	})
+
 	authGroup := r.Group("/")
 
-	authGroup.Use(a.UserIsLoggedIn())
+	authGroup.Use(a.UserIsLoggedIn(), a.UserIsActive(d))
 	{
+		authGroup.POST("/logout", func(c *gin.Context) {
+			logout(c, d)
+		})
+
+		authGroup.POST("/logout/all", func(c *gin.Context) {
+			logoutAll(c, d)
+		})
 		authGroup.GET("/thread/:threadid", func(c *gin.Context) {
 			threadID := c.Param("threadid")
 			getThread(c, d, threadID)
@@ -265,6 +268,21 @@ func setupRouter(d database.IDatabase) *gin.Engine {
 			getThreads(c, d, 20, since)
 		})
 
+		authGroup.GET("/categories", func(c *gin.Context) {
+			getCategories(c, d)
+		})
+
+		authGroup.GET("/category/:categoryid", func(c *gin.Context) {
+			categoryID := c.Param("categoryid")
+			getCategory(c, d, categoryID)
+		})
+
+		authGroup.GET("/category/:categoryid/threads/:since", func(c *gin.Context) {
+			categoryID := c.Param("categoryid")
+			since := c.Param("since")
+			getCategoryThreads(c, d, 20, categoryID, since)
+		})
+
 		authGroup.GET("/message/:messageid", func(c *gin.Context) {
 			messageID := c.Param("messageid")
 			getMessage(c, d, messageID)
@@ -280,23 +298,23 @@ func setupRouter(d database.IDatabase) *gin.Engine {
 			getMessagePosts(c, d, messageID)
 		})
 
-		authGroup.POST("/thread", func(c *gin.Context) {
+		authGroup.POST("/thread", a.UserCanWrite(), func(c *gin.Context) {
 			postThread(c, d)
 		})
 
-		authGroup.POST("/post", func(c *gin.Context) {
+		authGroup.POST("/post", a.UserCanWrite(), func(c *gin.Context) {
 			postPost(c, d)
 		})
 
-		authGroup.POST("/newmessage", func(c *gin.Context) {
+		authGroup.POST("/newmessage", a.UserCanWrite(), func(c *gin.Context) {
 			postMessage(c, d)
 		})
 
-		authGroup.POST("/message", func(c *gin.Context) {
+		authGroup.POST("/message", a.UserCanWrite(), func(c *gin.Context) {
 			postMessagePost(c, d)
 		})
 
-		authGroup.PATCH("/posts/:postid", func(c *gin.Context) {
+		authGroup.PATCH("/posts/:postid", a.UserCanWrite(), func(c *gin.Context) {
 			postID := c.Param("postid")
 			editPost(c, d, postID)
 		})
@@ -306,16 +324,147 @@ func setupRouter(d database.IDatabase) *gin.Engine {
 			getUserInfo(c, d, userID)
 		})
 
+		authGroup.GET("/users/online", func(c *gin.Context) {
+			c.JSON(http.StatusOK, tracker.Online())
+		})
+
 		authGroup.GET("/users", func(c *gin.Context) {
 			search := c.Query("search")
 			getUsers(c, d, search)
 		})
 
-		authGroup.Use(a.UserIsInRole(d, []constants.Role{constants.Admin, constants.Mod}))
+		authGroup.GET("/notifications", func(c *gin.Context) {
+			unreadOnly := c.Query("unread") == "true"
+			getNotifications(c, d, 50, unreadOnly)
+		})
+
+		authGroup.GET("/notifications/unread", func(c *gin.Context) {
+			getUnreadNotificationCount(c, d)
+		})
+
+		authGroup.POST("/notifications/read", func(c *gin.Context) {
+			markAllNotificationsRead(c, d)
+		})
+
+		authGroup.POST("/notification/:notificationid/read", func(c *gin.Context) {
+			notificationID := c.Param("notificationid")
+			markNotificationRead(c, d, notificationID)
+		})
+
+		authGroup.POST("/post/:postid/report", func(c *gin.Context) {
+			postID := c.Param("postid")
+			reportPost(c, d, postID)
+		})
+
+		authGroup.GET("/modactions", func(c *gin.Context) {
+			getPublicModActions(c, d, 50)
+		})
+
+		authGroup.DELETE("/thread/:threadid", a.RequireCategoryPermission(d, constants.PermThreadDelete, threadCategoryOf(d)), func(c *gin.Context) {
+			threadID := c.Param("threadid")
+			deleteThread(c, d, threadID)
+		})
+
+		authGroup.POST("/thread/:threadid/restore", a.RequireCategoryPermission(d, constants.PermThreadRestore, threadCategoryOf(d)), func(c *gin.Context) {
+			threadID := c.Param("threadid")
+			restoreThread(c, d, threadID)
+		})
+
+		authGroup.DELETE("/post/:postid", a.RequireCategoryPermission(d, constants.PermPostDelete, postCategoryOf(d)), func(c *gin.Context) {
+			postID := c.Param("postid")
+			deletePost(c, d, postID)
+		})
+
+		authGroup.POST("/post/:postid/restore", a.RequireCategoryPermission(d, constants.PermPostRestore, postCategoryOf(d)), func(c *gin.Context) {
+			postID := c.Param("postid")
+			restorePost(c, d, postID)
+		})
+
+		authGroup.PUT("/user/:userid/role", a.RequirePermission(d, constants.PermUserRole), func(c *gin.Context) {
+			userID := c.Param("userid")
+			changeUserRole(c, d, userID)
+		})
+
+		authGroup.GET("/user/:userid/sanctions", a.RequirePermission(d, constants.PermUserMute, constants.PermUserBan), func(c *gin.Context) {
+			userID := c.Param("userid")
+			getSanctions(c, d, userID)
+		})
+
+		authGroup.POST("/user/:userid/sanction", a.RequirePermission(d, constants.PermUserMute, constants.PermUserBan), func(c *gin.Context) {
+			userID := c.Param("userid")
+			sanctionUser(c, d, userID)
+		})
+
+		authGroup.DELETE("/sanction/:sanctionid", a.RequirePermission(d, constants.PermUserMute, constants.PermUserBan), func(c *gin.Context) {
+			sanctionID := c.Param("sanctionid")
+			liftSanction(c, d, sanctionID)
+		})
+
+		authGroup.GET("/reports", a.RequirePermission(d, constants.PermReportManage), func(c *gin.Context) {
+			status := c.Query("status")
+			reason := c.Query("reason")
+			getReportQueue(c, d, 50, status, reason)
+		})
+
+		authGroup.POST("/report/:reportid/resolve", a.RequirePermission(d, constants.PermReportManage), func(c *gin.Context) {
+			reportID := c.Param("reportid")
+			resolveReport(c, d, reportID)
+		})
+
+		authGroup.POST("/category", a.RequirePermission(d, constants.PermCategoryManage), func(c *gin.Context) {
+			postCategory(c, d)
+		})
+
+		authGroup.PUT("/categories/order", a.RequirePermission(d, constants.PermCategoryManage), func(c *gin.Context) {
+			reorderCategories(c, d)
+		})
+
+		authGroup.DELETE("/category/:categoryid", a.RequireCategoryPermission(d, constants.PermCategoryManage, categoryParam), func(c *gin.Context) {
+			categoryID := c.Param("categoryid")
+			archiveCategory(c, d, categoryID)
+		})
+
+		authGroup.GET("/modlog", a.RequirePermission(d, constants.PermModLogView), func(c *gin.Context) {
+			filter := model.ModLogFilter{
+				Action:     c.Query("action"),
+				ActorId:    c.Query("actor"),
+				TargetType: c.Query("targetType"),
+				TargetId:   c.Query("target"),
+				Limit:      100,
+			}
+			getModLog(c, d, filter)
+		})
+
+		authGroup.GET("/emails", a.RequirePermission(d, constants.PermEmailManage), func(c *gin.Context) {
+			status := c.Query("status")
+			getOutboxEmails(c, d, 50, status)
+		})
+
+		authGroup.POST("/email/:emailid/retry", a.RequirePermission(d, constants.PermEmailManage), func(c *gin.Context) {
+			emailID := c.Param("emailid")
+			retryEmail(c, d, emailID)
+		})
+
+		permissionGroup := authGroup.Group("/")
+		permissionGroup.Use(a.RequirePermission(d, constants.PermPermissionManage))
 		{
-			authGroup.DELETE("/thread/:threadid", func(c *gin.Context) {
-				threadID := c.Param("threadid")
-				deleteThread(c, d, threadID)
+			permissionGroup.GET("/permissions", func(c *gin.Context) {
+				getRolePermissions(c, d)
+			})
+
+			permissionGroup.PUT("/permissions/:role", func(c *gin.Context) {
+				role := c.Param("role")
+				setRolePermissions(c, d, role)
+			})
+
+			permissionGroup.GET("/category/:categoryid/permissions", func(c *gin.Context) {
+				categoryID := c.Param("categoryid")
+				getCategoryPermissions(c, d, categoryID)
+			})
+
+			permissionGroup.PUT("/category/:categoryid/permissions", func(c *gin.Context) {
+				categoryID := c.Param("categoryid")
+				setCategoryPermissions(c, d, categoryID)
 			})
 		}
 	}
@@ -335,29 +484,19 @@ func allowedCorsOrigins() []string {
 		viper.GetString(constants.BoardURLCorsEnvVariable)}
 }
 
-// Websocket Handler
-func webSocketHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := webSocketUpgrade.Upgrade(w, r, nil)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	client := &client{id: uuid.NewV4().String(), socket: conn, send: make(chan []byte)}
-
-	manager.register <- client
-
-	go client.read()
-	go client.write()
-}
-
 // Handlers
 func getThread(c *gin.Context, d database.IDatabase, threadID string) {
 	thread, err := d.GetThread(threadID)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
 	}
+
+	if _, ok := accessibleCategory(c, d, thread.CategoryId); !ok {
+		return
+	}
+
 	c.JSON(http.StatusOK, thread)
 }
 
@@ -366,12 +505,20 @@ func getPost(c *gin.Context, d database.IDatabase, postID string) {
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
+	}
+
+	if _, ok := threadIsAccessible(c, d, post.ThreadId); !ok {
+		return
 	}
+
+	post.Mentions = postMentions(d, []string{post.Id})[post.Id]
 	c.JSON(http.StatusOK, post)
 }
 
 func getThreads(c *gin.Context, d database.IDatabase, num int, since string) {
-	threads, err := d.GetThreads(num, since)
+	role, _ := auth.UserRole(c)
+	threads, err := d.GetThreads(num, since, role)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, "Uh oh")
@@ -380,157 +527,108 @@ func getThreads(c *gin.Context, d database.IDatabase, num int, since string) {
 	}
 }
 
-func getMessages(c *gin.Context, d database.IDatabase, num int, userID string) {
-	messages, err := d.GetMessages(num, userID)
+func getCategories(c *gin.Context, d database.IDatabase) {
+	role, _ := auth.UserRole(c)
+	categories, err := d.GetCategories(role)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, "Uh oh")
 	} else {
-		c.JSON(http.StatusOK, messages)
+		c.JSON(http.StatusOK, categories)
 	}
 }
 
-func getUserInfo(c *gin.Context, d database.IDatabase, userID string) {
-	userInfo, err := d.GetUserInfo(userID)
-	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, "Uh oh")
-	} else {
-		c.JSON(http.StatusOK, userInfo)
+func getCategory(c *gin.Context, d database.IDatabase, categoryID string) {
+	if category, ok := accessibleCategory(c, d, categoryID); ok {
+		c.JSON(http.StatusOK, category)
 	}
 }
 
-func getUsers(c *gin.Context, d database.IDatabase, search string) {
-	userInfo, err := d.GetUsers(search)
-	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, "Uh oh")
-	} else {
-		c.JSON(http.StatusOK, userInfo)
+func getCategoryThreads(c *gin.Context, d database.IDatabase, num int, categoryID string, since string) {
+	category, ok := accessibleCategory(c, d, categoryID)
+	if !ok {
+		return
 	}
-}
 
-func getMessagePosts(c *gin.Context, d database.IDatabase, messageID string) {
-	messages, err := d.GetMessagePosts(messageID)
+	threads, err := d.GetCategoryThreads(category.Id, num, since)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, "Uh oh")
 	} else {
-		c.JSON(http.StatusOK, messages)
+		c.JSON(http.StatusOK, threads)
 	}
 }
 
-func getPosts(c *gin.Context, d database.IDatabase, threadID string) {
-	posts, err := d.GetPosts(threadID)
-	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, "Uh oh")
-	} else {
-		c.JSON(http.StatusOK, posts)
+func postCategory(c *gin.Context, d database.IDatabase) {
+	category := model.Category{RequiredRole: int(constants.User)}
+	c.BindJSON(&category)
+
+	if strings.TrimSpace(category.Title) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A category needs a title"})
+		return
 	}
-}
 
-func getMessage(c *gin.Context, d database.IDatabase, messageID string) {
-	message, err := d.GetMessage(messageID)
-	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, "Uh oh")
+	if category.RequiredRole < int(constants.Admin) || category.RequiredRole > int(constants.User) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid required role"})
+		return
 	}
-	c.JSON(http.StatusOK, message)
-}
 
-func postMessage(c *gin.Context, d database.IDatabase) {
-	var newMessage model.NewMessage
-	c.BindJSON(&newMessage)
-	log.Info(newMessage)
-	message, err := d.PostMessage(&newMessage)
+	newCategory, err := d.PostCategory(&category)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, message)
+	c.JSON(http.StatusCreated, newCategory)
+	logModAction(c, d, constants.ModCategoryCreate, constants.ModTargetCategory, newCategory.Id, c.Query("reason"),
+		nil, newCategory)
 }
 
-func postMessagePost(c *gin.Context, d database.IDatabase) {
-	var message model.MessagePost
-	c.BindJSON(&message)
-	newMessage, err := d.PostMessagePost(&message)
+func reorderCategories(c *gin.Context, d database.IDatabase) {
+	var categoryIDs []string
+	c.BindJSON(&categoryIDs)
+
+	err := d.ReorderCategories(categoryIDs)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	} else {
-		bytes, err := json.Marshal(&newMessage)
-		if err != nil {
-			return
-		}
-
-		c.JSON(http.StatusCreated, newMessage)
-
-		if c, err := gRedisConn(); err != nil {
-			log.Printf("Error on redis conn. %s", err)
-		} else {
-			c.Do("PUBLISH", "message_posts", bytes)
-		}
+		c.Status(http.StatusOK)
+		logModAction(c, d, constants.ModCategoryReorder, constants.ModTargetCategory, "", c.Query("reason"),
+			nil, categoryIDs)
 	}
 }
 
-func postThread(c *gin.Context, d database.IDatabase) {
-	var newThread model.NewThread
-	c.BindJSON(&newThread)
-	thread, err := d.PostThread(&newThread)
+func archiveCategory(c *gin.Context, d database.IDatabase, categoryID string) {
+	category, err := d.GetCategory(categoryID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, thread)
-}
-
-func postPost(c *gin.Context, d database.IDatabase) {
-	var post model.Post
-	c.BindJSON(&post)
-	newPost, err := d.PostPost(&post)
+	err = d.ArchiveCategory(categoryID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	} else {
-		bytes, err := json.Marshal(&newPost)
-		if err != nil {
-			return
-		}
-
-		c.JSON(http.StatusCreated, newPost)
-		if c, err := gRedisConn(); err != nil {
-			log.Printf("Error on redis conn. %s", err)
-		} else {
-			c.Do("PUBLISH", "posts", bytes)
-		}
+		c.Status(http.StatusOK)
+		archived := category
+		archived.Archived = true
+		logModAction(c, d, constants.ModCategoryArchive, constants.ModTargetCategory, categoryID, c.Query("reason"),
+			category, archived)
 	}
 }
 
-func editPost(c *gin.Context, d database.IDatabase, postID string) {
-	var post model.Post
-	c.BindJSON(&post)
-	post, err := d.EditPost(postID, post.Body)
+func getOutboxEmails(c *gin.Context, d database.IDatabase, num int, status string) {
+	emails, err := d.GetOutboxEmails(status, num)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
 	} else {
-
-		bytes, err := json.Marshal(&post)
-		if err != nil {
-			return
-		}
-
-		c.JSON(http.StatusOK, post)
-		if c, err := gRedisConn(); err != nil {
-			log.Printf("Error on redis conn. %s", err)
-		} else {
-			c.Do("PUBLISH", "posts", bytes)
-		}
+		c.JSON(http.StatusOK, emails)
 	}
 }
 
-func deleteThread(c *gin.Context, d database.IDatabase, threadID string) {
-	err := d.DeleteThread(threadID)
+func retryEmail(c *gin.Context, d database.IDatabase, emailID string) {
+	err := d.RetryEmail(emailID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	} else {
@@ -538,28 +636,1181 @@ func deleteThread(c *gin.Context, d database.IDatabase, threadID string) {
 	}
 }
 
-func checkCredentials(c *gin.Context, d database.IDatabase) {
-	var credentials model.Credentials
-	c.BindJSON(&credentials)
-	var user model.User
-
-	user, err := d.GetUser(credentials.Username)
+// accessibleCategory loads a category, responding with an error if it doesn't exist or the user's role
+// can't see it. An empty ID loads the default category.
+func accessibleCategory(c *gin.Context, d database.IDatabase, categoryID string) (model.Category, bool) {
+	category, err := d.GetCategory(categoryID)
 	if err != nil {
-		log.WithFields(log.Fields{"username": credentials.Username}).Error("Can't find that username")
-		c.JSON(http.StatusBadRequest, gin.H{"err": "Can't find that username"})
-		return
+		if err == database.ErrNoCategory {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return category, false
 	}
 
-	if user.UserRole == int(constants.NeedsConfirmation) {
-		log.WithFields(log.Fields{
-			"username": credentials.Username,
-		}).Error("User account needs verified")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"err": "User account needs verified",
-		})
+	role, _ := auth.UserRole(c)
+	if !role.HasAccess(constants.Role(category.RequiredRole)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+		return category, false
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.Password, []byte(credentials.Password))
+	return category, true
+}
+
+// threadIsAccessible responds with an error unless the thread exists and is in a category the user can see,
+// returning the thread's category.
+func threadIsAccessible(c *gin.Context, d database.IDatabase, threadID string) (model.Category, bool) {
+	thread, err := d.GetThread(threadID)
+	if err != nil {
+		if err == database.ErrNoThread {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return model.Category{}, false
+	}
+
+	return accessibleCategory(c, d, thread.CategoryId)
+}
+
+func getMessages(c *gin.Context, d database.IDatabase, num int, userID string) {
+	if currentUserID, _ := auth.UserID(c); currentUserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+		return
+	}
+
+	messages, err := d.GetMessages(num, userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, messages)
+	}
+}
+
+func getUserInfo(c *gin.Context, d database.IDatabase, userID string) {
+	userInfo, err := d.GetUserInfo(userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, userInfo)
+	}
+}
+
+func getUsers(c *gin.Context, d database.IDatabase, search string) {
+	userInfo, err := d.GetUsers(search)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, userInfo)
+	}
+}
+
+func getMessagePosts(c *gin.Context, d database.IDatabase, messageID string) {
+	if !messageIsAccessible(c, d, messageID) {
+		return
+	}
+
+	messages, err := d.GetMessagePosts(messageID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		ids := make([]string, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.Id)
+		}
+		mentions := postMentions(d, ids)
+		for i := range messages {
+			messages[i].Mentions = mentions[messages[i].Id]
+		}
+		c.JSON(http.StatusOK, messages)
+	}
+}
+
+func getPosts(c *gin.Context, d database.IDatabase, threadID string) {
+	page, err := postPageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := threadIsAccessible(c, d, threadID); !ok {
+		return
+	}
+
+	posts, err := d.GetPosts(threadID, page)
+	if err != nil {
+		if err == model.ErrInvalidCursor || err == database.ErrNoPost {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		ids := make([]string, 0, len(posts.Posts))
+		for _, p := range posts.Posts {
+			ids = append(ids, p.Id)
+		}
+		mentions := postMentions(d, ids)
+		for i := range posts.Posts {
+			posts.Posts[i].Mentions = mentions[posts.Posts[i].Id]
+		}
+		c.JSON(http.StatusOK, posts)
+	}
+}
+
+// postPageRequest reads the after, before, post and limit query parameters used to page through a thread.
+func postPageRequest(c *gin.Context) (model.PostPageRequest, error) {
+	page := model.PostPageRequest{
+		After:  c.Query("after"),
+		Before: c.Query("before"),
+		Around: c.Query("post"),
+		Limit:  defaultPostPageSize,
+	}
+
+	set := 0
+	for _, v := range []string{page.After, page.Before, page.Around} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return page, errors.New("Only one of after, before or post can be used")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return page, errors.New("Limit must be a positive number")
+		}
+		if l > maxPostPageSize {
+			l = maxPostPageSize
+		}
+		page.Limit = l
+	}
+
+	return page, nil
+}
+
+func getMessage(c *gin.Context, d database.IDatabase, messageID string) {
+	if !messageIsAccessible(c, d, messageID) {
+		return
+	}
+
+	message, err := d.GetMessage(messageID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// messageIsAccessible responds with an error unless the logged in user is a member of the message.
+func messageIsAccessible(c *gin.Context, d database.IDatabase, messageID string) bool {
+	userID, _ := auth.UserID(c)
+	member, err := d.IsMessageMember(messageID, userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+		return false
+	}
+
+	if !member {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+		return false
+	}
+
+	return true
+}
+
+func postMessage(c *gin.Context, d database.IDatabase) {
+	var newMessage model.NewMessage
+	c.BindJSON(&newMessage)
+
+	userID, _ := auth.UserID(c)
+	newMessage.T.UserId = userID
+	newMessage.P.UserId = userID
+
+	isMember := false
+	for _, mm := range newMessage.M {
+		if mm.UserId == userID {
+			isMember = true
+		}
+	}
+	if !isMember {
+		newMessage.M = append(newMessage.M, model.MessageMember{UserId: userID})
+	}
+
+	message, err := d.PostMessage(&newMessage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mentioned []string
+	message.P.Mentions, mentioned = saveMentions(d, message.P.Id, message.P.Body)
+	c.JSON(http.StatusCreated, message)
+
+	// Let every member know about the new conversation, so they can subscribe to it
+	for _, mm := range newMessage.M {
+		publish(events.UserTopic(mm.UserId), events.MessageCreated, message)
+	}
+	notifier.Message(message.T.Id, userID)
+	notifyMessageMentions(d, message.P, mentioned)
+}
+
+func postMessagePost(c *gin.Context, d database.IDatabase) {
+	var message model.MessagePost
+	c.BindJSON(&message)
+
+	if !messageIsAccessible(c, d, message.MessageId) {
+		return
+	}
+
+	message.UserId, _ = auth.UserID(c)
+	newMessage, err := d.PostMessagePost(&message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		var mentioned []string
+		newMessage.Mentions, mentioned = saveMentions(d, newMessage.Id, newMessage.Body)
+		c.JSON(http.StatusCreated, newMessage)
+		publish(events.MessageTopic(newMessage.MessageId), events.MessagePostCreated, newMessage)
+		notifier.Message(newMessage.MessageId, newMessage.UserId)
+		notifyMessageMentions(d, newMessage, mentioned)
+	}
+}
+
+func postThread(c *gin.Context, d database.IDatabase) {
+	var newThread model.NewThread
+	c.BindJSON(&newThread)
+
+	newThread.T.UserId, _ = auth.UserID(c)
+
+	category, ok := accessibleCategory(c, d, newThread.T.CategoryId)
+	if !ok {
+		return
+	}
+
+	if category.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrCategoryArchived.Error()})
+		return
+	}
+
+	newThread.T.CategoryId = category.Id
+	thread, err := d.PostThread(&newThread)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mentioned []string
+	thread.P.Mentions, mentioned = saveMentions(d, thread.P.Id, thread.P.Body)
+	c.JSON(http.StatusCreated, thread)
+	publishThreadSummary(d, thread.T.Id, events.ThreadCreated)
+	notifyThreadMentions(d, thread.P, mentioned)
+}
+
+func postPost(c *gin.Context, d database.IDatabase) {
+	var post model.Post
+	c.BindJSON(&post)
+
+	category, ok := threadIsAccessible(c, d, post.ThreadId)
+	if !ok {
+		return
+	}
+
+	if category.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrCategoryArchived.Error()})
+		return
+	}
+
+	post.UserId, _ = auth.UserID(c)
+
+	newPost, err := d.PostPost(&post)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		var mentioned []string
+		newPost.Mentions, mentioned = saveMentions(d, newPost.Id, newPost.Body)
+		c.JSON(http.StatusCreated, newPost)
+		publish(events.ThreadTopic(newPost.ThreadId), events.PostCreated, newPost)
+		publishThreadSummary(d, newPost.ThreadId, events.ThreadBumped)
+		notifier.Reply(newPost)
+		notifyThreadMentions(d, newPost, mentioned)
+	}
+}
+
+// publishThreadSummary lets the thread index know a thread was created or has a new post, so it can be
+// moved to the top. Threads in restricted categories only show up for users who can see them when they
+// reload.
+func publishThreadSummary(d database.IDatabase, threadID string, eventType events.Type) {
+	summary, err := d.GetThreadSummary(threadID)
+	if err != nil {
+		log.WithFields(log.Fields{"threadID": threadID}).Error(err)
+		return
+	}
+
+	if constants.User.HasAccess(constants.Role(summary.RequiredRole)) {
+		publish(events.ThreadsIndexTopic, eventType, summary)
+	}
+}
+
+// categoryIsPublic reports whether every user can see threads in a category, which is what decides whether
+// events about them can go to the thread index. Categories that can't be found aren't public.
+func categoryIsPublic(d database.IDatabase, categoryID string) bool {
+	category, err := d.GetCategory(categoryID)
+	if err != nil {
+		log.WithFields(log.Fields{"categoryID": categoryID}).Error(err)
+		return false
+	}
+
+	return constants.User.HasAccess(constants.Role(category.RequiredRole))
+}
+
+func editPost(c *gin.Context, d database.IDatabase, postID string) {
+	existing, err := d.GetPost(postID)
+	if err != nil {
+		if err == database.ErrNoPost {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return
+	}
+
+	userID, _ := auth.UserID(c)
+	if existing.UserId != userID {
+		categoryID, err := d.GetPostCategoryID(postID)
+		if err != nil || !auth.HasPermission(c, d, constants.PermPostEditAny, categoryID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the author of a post can edit it"})
+			return
+		}
+	}
+
+	var post model.Post
+	c.BindJSON(&post)
+	post, err = d.EditPost(postID, post.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		var mentioned []string
+		post.Mentions, mentioned = saveMentions(d, post.Id, post.Body)
+		c.JSON(http.StatusOK, post)
+		publish(events.ThreadTopic(post.ThreadId), events.PostEdited, post)
+		notifyThreadMentions(d, post, mentioned)
+
+		if existing.UserId != userID {
+			logModAction(c, d, constants.ModPostEdit, constants.ModTargetPost, postID, c.Query("reason"),
+				existing, post)
+		}
+	}
+}
+
+// saveMentions stores the @mentions in a post, returning them along with the users who are mentioned in
+// it for the first time. The post has already been saved, so failures are only logged.
+func saveMentions(d database.IDatabase, postID string, body string) ([]model.Mention, []string) {
+	mentions, mentioned, err := d.SavePostMentions(postID, mention.Parse(body))
+	if err != nil {
+		log.WithFields(log.Fields{"postID": postID}).Error(err)
+		return nil, nil
+	}
+
+	return mentions, mentioned
+}
+
+// postMentions loads the mentions in posts, keyed by post ID. Posts are still worth showing without
+// them, so failures are only logged.
+func postMentions(d database.IDatabase, postIDs []string) map[string][]model.Mention {
+	mentions, err := d.GetPostMentions(postIDs)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+
+	return mentions
+}
+
+// notifyThreadMentions notifies users mentioned in a thread post, as long as they can read the thread.
+func notifyThreadMentions(d database.IDatabase, post model.Post, userIDs []string) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	thread, err := d.GetThread(post.ThreadId)
+	if err != nil {
+		log.WithFields(log.Fields{"threadID": post.ThreadId}).Error(err)
+		return
+	}
+
+	category, err := d.GetCategory(thread.CategoryId)
+	if err != nil {
+		log.WithFields(log.Fields{"categoryID": thread.CategoryId}).Error(err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		user, err := d.GetUserByID(userID)
+		if err != nil {
+			log.WithFields(log.Fields{"userID": userID}).Error(err)
+			continue
+		}
+
+		if constants.Role(user.UserRole).HasAccess(constants.Role(category.RequiredRole)) {
+			notifier.Mention(userID, post.UserId, post.ThreadId, post.Id)
+		}
+	}
+}
+
+// notifyMessageMentions notifies users mentioned in a message post, as long as they're in the message.
+func notifyMessageMentions(d database.IDatabase, post model.MessagePost, userIDs []string) {
+	for _, userID := range userIDs {
+		member, err := d.IsMessageMember(post.MessageId, userID)
+		if err != nil {
+			log.WithFields(log.Fields{"messageID": post.MessageId, "userID": userID}).Error(err)
+			continue
+		}
+
+		if member {
+			notifier.Mention(userID, post.UserId, post.MessageId, post.Id)
+		}
+	}
+}
+
+func deleteThread(c *gin.Context, d database.IDatabase, threadID string) {
+	thread, err := d.GetThread(threadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = d.DeleteThread(threadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.Status(http.StatusOK)
+		deleted := events.Deleted{Id: threadID}
+		publish(events.ThreadTopic(threadID), events.ThreadDeleted, deleted)
+		if categoryIsPublic(d, thread.CategoryId) {
+			publish(events.ThreadsIndexTopic, events.ThreadDeleted, deleted)
+		}
+
+		modID, _ := auth.UserID(c)
+		if thread.UserId != modID {
+			notifier.ModAction(thread.UserId, modID, threadID, fmt.Sprintf("Your thread \"%s\" was deleted", thread.Title))
+		}
+		logModAction(c, d, constants.ModThreadDelete, constants.ModTargetThread, threadID, c.Query("reason"),
+			thread, nil)
+	}
+}
+
+func restoreThread(c *gin.Context, d database.IDatabase, threadID string) {
+	err := d.RestoreThread(threadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+	publishThreadSummary(d, threadID, events.ThreadCreated)
+
+	thread, err := d.GetThread(threadID)
+	if err != nil {
+		log.Error(err)
+	}
+	logModAction(c, d, constants.ModThreadRestore, constants.ModTargetThread, threadID, c.Query("reason"), nil, thread)
+}
+
+func deletePost(c *gin.Context, d database.IDatabase, postID string) {
+	post, err := d.GetPost(postID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = removePost(c, d, post, c.Query("reason")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// removePost deletes a post on behalf of a mod, letting its author know and recording it in the mod log
+// with the reason they gave.
+func removePost(c *gin.Context, d database.IDatabase, post model.Post, reason string) error {
+	if err := d.DeletePost(post.Id); err != nil {
+		return err
+	}
+
+	publish(events.ThreadTopic(post.ThreadId), events.PostDeleted, events.Deleted{Id: post.Id})
+
+	modID, _ := auth.UserID(c)
+	if post.UserId != modID {
+		notifier.ModAction(post.UserId, modID, post.ThreadId, "Your post was removed by a moderator")
+	}
+	logModAction(c, d, constants.ModPostDelete, constants.ModTargetPost, post.Id, reason, post, nil)
+
+	return nil
+}
+
+func restorePost(c *gin.Context, d database.IDatabase, postID string) {
+	err := d.RestorePost(postID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := d.GetPost(postID)
+	if err != nil {
+		log.Error(err)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+	publish(events.ThreadTopic(post.ThreadId), events.PostCreated, post)
+	logModAction(c, d, constants.ModPostRestore, constants.ModTargetPost, postID, c.Query("reason"), nil, post)
+}
+
+// logModAction records a privileged action in the mod log, along with the reason the mod gave for it. Most
+// actions take the reason in the reason query parameter, but sanctions and report resolutions take it in
+// the body. The action has already happened, so failures are only logged.
+func logModAction(c *gin.Context, d database.IDatabase, action constants.ModAction, targetType constants.ModTarget,
+	targetID string, reason string, before interface{}, after interface{}) {
+	actorID, _ := auth.UserID(c)
+	entry := model.ModLogEntry{
+		ActorId:    actorID,
+		Action:     string(action),
+		TargetType: string(targetType),
+		TargetId:   targetID,
+		Reason:     reason,
+		Before:     before,
+		After:      after,
+	}
+
+	if err := d.AppendModLog(&entry); err != nil {
+		log.WithFields(log.Fields{"action": action, "targetID": targetID}).Error(err)
+	}
+}
+
+func getModLog(c *gin.Context, d database.IDatabase, filter model.ModLogFilter) {
+	entries, err := d.GetModLog(filter)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// getPublicModActions lists recent mod actions without who took them or what the targets looked like,
+// so anyone can see how the board is moderated. The IDs of targets in categories the user can't see are
+// hidden, and changes to permissions are left out since they configure the board rather than moderate it.
+func getPublicModActions(c *gin.Context, d database.IDatabase, num int) {
+	entries, err := d.GetModLog(model.ModLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetId:   c.Query("target"),
+		Limit:      num,
+	})
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
+	}
+
+	role, _ := auth.UserRole(c)
+	actions := make([]model.PublicModAction, 0, len(entries))
+	for _, e := range entries {
+		if e.Action == string(constants.ModPermissions) {
+			continue
+		}
+
+		action := model.PublicModAction{
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetId:   e.TargetId,
+			Reason:     e.Reason,
+			CreatedAt:  e.CreatedAt,
+		}
+		if !role.HasAccess(constants.Role(e.TargetRequiredRole)) {
+			action.TargetId = ""
+		}
+		actions = append(actions, action)
+	}
+
+	c.JSON(http.StatusOK, actions)
+}
+
+func reportPost(c *gin.Context, d database.IDatabase, postID string) {
+	post, err := d.GetPost(postID)
+	if err != nil {
+		if err == database.ErrNoPost {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return
+	}
+
+	if _, ok := threadIsAccessible(c, d, post.ThreadId); !ok {
+		return
+	}
+
+	var report model.Report
+	c.BindJSON(&report)
+
+	if !validReportReason(report.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown report reason"})
+		return
+	}
+
+	report.PostId = postID
+	report.ReporterId, _ = auth.UserID(c)
+	err = d.CreateReport(&report)
+	if err != nil {
+		if err == database.ErrAlreadyReported {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range constants.ReportReasons {
+		if string(r) == reason {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getReportQueue(c *gin.Context, d database.IDatabase, num int, status string, reason string) {
+	queue, err := d.GetReportQueue(status, reason, num)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, queue)
+	}
+}
+
+// resolveReport resolves every open report about the reported post, after doing whatever the mod decided
+// to do about it.
+func resolveReport(c *gin.Context, d database.IDatabase, reportID string) {
+	var resolution model.ReportResolution
+	c.BindJSON(&resolution)
+
+	report, err := d.GetReport(reportID)
+	if err != nil {
+		if err == database.ErrNoReport {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return
+	}
+
+	if report.Status != string(constants.ReportOpen) {
+		c.JSON(http.StatusConflict, gin.H{"error": "That report has already been resolved"})
+		return
+	}
+
+	modID, _ := auth.UserID(c)
+	status := constants.ReportResolved
+
+	switch action := constants.ReportAction(resolution.Action); action {
+	case constants.ReportDismiss:
+		status = constants.ReportDismissed
+	case constants.ReportDeletePost, constants.ReportMuteAuthor, constants.ReportBanAuthor:
+		if !moderateReportedPost(c, d, report, action, resolution) {
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown action"})
+		return
+	}
+
+	err = d.ResolveReports(report.PostId, modID, status, resolution.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// moderateReportedPost deletes a reported post, or mutes or bans its author, responding with an error if
+// it can't.
+func moderateReportedPost(c *gin.Context, d database.IDatabase, report model.Report, action constants.ReportAction,
+	resolution model.ReportResolution) bool {
+	post, err := d.GetPost(report.PostId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	reason := resolution.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Reported post (%s)", report.Reason)
+	}
+
+	if action == constants.ReportDeletePost {
+		categoryID, err := d.GetPostCategoryID(post.Id)
+		if err != nil || !auth.HasPermission(c, d, constants.PermPostDelete, categoryID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+			return false
+		}
+
+		if err = removePost(c, d, post, reason); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		return true
+	}
+
+	sanctionType := constants.SanctionBan
+	if action == constants.ReportMuteAuthor {
+		sanctionType = constants.SanctionMute
+	}
+
+	_, ok := issueSanction(c, d, post.UserId, model.NewSanction{
+		Type:   string(sanctionType),
+		Reason: reason,
+		Hours:  resolution.Hours,
+	})
+	return ok
+}
+
+// changeUserRole gives a user a new role, as long as whoever is asking is allowed to give it.
+func changeUserRole(c *gin.Context, d database.IDatabase, userID string) {
+	var request model.RoleChangeRequest
+	c.BindJSON(&request)
+
+	user, err := d.GetUserByID(userID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": userID}).Error(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": database.ErrNoUser.Error()})
+		return
+	}
+
+	actorRole, _ := auth.UserRole(c)
+	from, to := constants.Role(user.UserRole), constants.Role(request.Role)
+	if err = policy.CanAssignRole(actorRole, from, to); err != nil {
+		if err == policy.ErrUseSanction {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	change := events.RoleChange{UserId: userID, Role: int(to)}
+	if from == to {
+		c.JSON(http.StatusOK, change)
+		return
+	}
+
+	if err = setUserRole(c, d, userID, from, to); err != nil {
+		if err == database.ErrLastAdmin {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	actorID, _ := auth.UserID(c)
+	notifier.ModAction(userID, actorID, "", fmt.Sprintf("Your role was changed from %s to %s", from, to))
+	c.JSON(http.StatusOK, change)
+}
+
+func getSanctions(c *gin.Context, d database.IDatabase, userID string) {
+	sanctions, err := d.GetSanctions(userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, sanctions)
+	}
+}
+
+func sanctionUser(c *gin.Context, d database.IDatabase, userID string) {
+	var newSanction model.NewSanction
+	c.BindJSON(&newSanction)
+
+	if s, ok := issueSanction(c, d, userID, newSanction); ok {
+		c.JSON(http.StatusCreated, s)
+	}
+}
+
+// issueSanction mutes or bans a user for a while on behalf of a mod, responding with an error if it
+// can't. Their clients are told about it, and banned users are signed out everywhere.
+func issueSanction(c *gin.Context, d database.IDatabase, userID string, newSanction model.NewSanction) (model.Sanction, bool) {
+	sanctionType := constants.SanctionType(newSanction.Type)
+	if sanctionType != constants.SanctionMute && sanctionType != constants.SanctionBan {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown sanction type"})
+		return model.Sanction{}, false
+	}
+
+	if newSanction.Hours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sanction can't last less than no time"})
+		return model.Sanction{}, false
+	}
+
+	if !auth.HasPermission(c, d, sanctionPermission(sanctionType), "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+		return model.Sanction{}, false
+	}
+
+	user, err := d.GetUserByID(userID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": userID}).Error(err)
+		c.JSON(http.StatusNotFound, gin.H{"error": database.ErrNoUser.Error()})
+		return model.Sanction{}, false
+	}
+
+	modRole, _ := auth.UserRole(c)
+	if err = policy.CanModerate(modRole, constants.Role(user.UserRole)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return model.Sanction{}, false
+	}
+
+	modID, _ := auth.UserID(c)
+	s := model.Sanction{
+		UserId:   userID,
+		Type:     newSanction.Type,
+		Reason:   newSanction.Reason,
+		IssuedBy: modID,
+	}
+	if err = d.CreateSanction(&s, time.Duration(newSanction.Hours)*time.Hour); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return model.Sanction{}, false
+	}
+
+	publish(events.UserTopic(userID), events.UserSanctioned, s)
+
+	action := constants.ModUserMute
+	if sanctionType == constants.SanctionBan {
+		action = constants.ModUserBan
+		if err := d.RevokeUserRefreshTokens(userID); err != nil {
+			log.Error(err)
+		}
+		if err := a.RevokeUserTokens(userID); err != nil {
+			log.Error(err)
+		}
+	}
+	logModAction(c, d, action, constants.ModTargetUser, userID, s.Reason, nil, s)
+
+	text := "You were " + map[constants.SanctionType]string{constants.SanctionMute: "muted", constants.SanctionBan: "banned"}[sanctionType]
+	if s.EndsAt != nil {
+		text += " until " + *s.EndsAt
+	}
+	if s.Reason != "" {
+		text += ": " + s.Reason
+	}
+	notifier.ModAction(userID, modID, "", text)
+
+	return s, true
+}
+
+func liftSanction(c *gin.Context, d database.IDatabase, sanctionID string) {
+	s, err := d.GetSanction(sanctionID)
+	if err != nil {
+		if err == database.ErrNoSanction {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !auth.HasPermission(c, d, sanctionPermission(constants.SanctionType(s.Type)), "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User doesn't have access"})
+		return
+	}
+
+	modID, _ := auth.UserID(c)
+	s, err = d.LiftSanction(sanctionID, modID)
+	if err != nil {
+		if err == database.ErrNoSanction {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+	logModAction(c, d, constants.ModSanctionLift, constants.ModTargetUser, s.UserId, c.Query("reason"), nil, s)
+	sanctionLifted(s)
+}
+
+// sanctionLifted lets a user know a sanction is over, whether it ran out or a mod lifted it.
+func sanctionLifted(s model.Sanction) {
+	publish(events.UserTopic(s.UserId), events.UserSanctionLifted, s)
+	notifier.ModAction(s.UserId, s.LiftedBy, "", fmt.Sprintf("Your %s has been lifted", s.Type))
+}
+
+// activeBan returns the ban sanction a user is under, if there is one. If sanctions can't be checked the
+// user isn't treated as banned, since UserIsActive checks again on every request.
+func activeBan(d database.IDatabase, userID string) (model.Sanction, bool) {
+	sanctions, err := d.GetActiveSanctions(userID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": userID}).Error(err)
+		return model.Sanction{}, false
+	}
+
+	return auth.FindSanction(sanctions, constants.SanctionBan)
+}
+
+// sanctionPermission is the permission needed to issue or lift a type of sanction.
+func sanctionPermission(sanctionType constants.SanctionType) constants.Permission {
+	if sanctionType == constants.SanctionBan {
+		return constants.PermUserBan
+	}
+	return constants.PermUserMute
+}
+
+// threadCategoryOf finds the category of the thread in the URL, for checking permissions in it.
+func threadCategoryOf(d database.IDatabase) auth.CategoryFunc {
+	return func(c *gin.Context) (string, error) {
+		return d.GetThreadCategoryID(c.Param("threadid"))
+	}
+}
+
+// postCategoryOf finds the category of the thread the post in the URL is in, for checking permissions in it.
+func postCategoryOf(d database.IDatabase) auth.CategoryFunc {
+	return func(c *gin.Context) (string, error) {
+		return d.GetPostCategoryID(c.Param("postid"))
+	}
+}
+
+func categoryParam(c *gin.Context) (string, error) {
+	return c.Param("categoryid"), nil
+}
+
+func getRolePermissions(c *gin.Context, d database.IDatabase) {
+	roles, err := d.GetRolePermissions()
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+// setRolePermissions replaces what a role is allowed to do everywhere on the board. Admins always keep
+// permission.manage, so nobody can lock everyone out of changing permissions.
+func setRolePermissions(c *gin.Context, d database.IDatabase, roleParam string) {
+	r, err := strconv.Atoi(roleParam)
+	role := constants.Role(r)
+	if err != nil || role < constants.Admin || role > constants.NeedsConfirmation {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	var permissions []string
+	c.BindJSON(&permissions)
+
+	managesPermissions := false
+	for _, p := range permissions {
+		if !validPermission(constants.Permission(p), constants.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission " + p})
+			return
+		}
+		managesPermissions = managesPermissions || constants.Permission(p) == constants.PermPermissionManage
+	}
+
+	if role == constants.Admin && !managesPermissions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins can't lose the permission.manage permission"})
+		return
+	}
+
+	before := rolePermissions(d, role)
+	if err = d.SetRolePermissions(role, permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	after := model.RolePermissions{Role: int(role), RoleName: role.String(), Permissions: permissions}
+	c.JSON(http.StatusOK, after)
+	logModAction(c, d, constants.ModPermissions, constants.ModTargetRole, strconv.Itoa(int(role)), c.Query("reason"),
+		before, after)
+}
+
+// rolePermissions returns the permissions a role has everywhere, for recording changes to them.
+func rolePermissions(d database.IDatabase, role constants.Role) model.RolePermissions {
+	roles, err := d.GetRolePermissions()
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, r := range roles {
+		if r.Role == int(role) {
+			return r
+		}
+	}
+
+	return model.RolePermissions{Role: int(role), RoleName: role.String(), Permissions: []string{}}
+}
+
+func getCategoryPermissions(c *gin.Context, d database.IDatabase, categoryID string) {
+	overrides, err := d.GetCategoryPermissions(categoryID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, overrides)
+	}
+}
+
+// setCategoryPermissions replaces the overrides of what roles are allowed to do in a category.
+func setCategoryPermissions(c *gin.Context, d database.IDatabase, categoryID string) {
+	if _, err := d.GetCategory(categoryID); err != nil {
+		if err == database.ErrNoCategory {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, "Uh oh")
+		}
+		return
+	}
+
+	var overrides []model.CategoryPermission
+	c.BindJSON(&overrides)
+
+	for _, o := range overrides {
+		role := constants.Role(o.Role)
+		if role < constants.Admin || role > constants.NeedsConfirmation {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		if !validPermission(constants.Permission(o.Permission), constants.CategoryPermissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Permission " + o.Permission + " can't be changed for a category"})
+			return
+		}
+	}
+
+	before, err := d.GetCategoryPermissions(categoryID)
+	if err != nil {
+		log.Error(err)
+	}
+
+	if err = d.SetCategoryPermissions(categoryID, overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, overrides)
+	logModAction(c, d, constants.ModPermissions, constants.ModTargetCategory, categoryID, c.Query("reason"),
+		before, overrides)
+}
+
+func validPermission(permission constants.Permission, permissions []constants.Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// setUserRole changes a user's role on behalf of a mod, lets their clients know and records it in the mod
+// log.
+func setUserRole(c *gin.Context, d database.IDatabase, userID string, from constants.Role, role constants.Role) error {
+	if err := d.SetUserRole(userID, role); err != nil {
+		return err
+	}
+
+	change := events.RoleChange{UserId: userID, Role: int(role)}
+	publish(events.UserTopic(userID), events.UserRoleChanged, change)
+
+	logModAction(c, d, constants.ModUserRole, constants.ModTargetUser, userID, c.Query("reason"),
+		events.RoleChange{UserId: userID, Role: int(from)}, change)
+
+	return nil
+}
+
+func getNotifications(c *gin.Context, d database.IDatabase, num int, unreadOnly bool) {
+	userID, _ := auth.UserID(c)
+	notifications, err := d.GetNotifications(userID, unreadOnly, num)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
+	}
+
+	unread, err := d.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+		return
+	}
+
+	c.JSON(http.StatusOK, model.NotificationPage{Notifications: notifications, Unread: unread})
+}
+
+func getUnreadNotificationCount(c *gin.Context, d database.IDatabase) {
+	userID, _ := auth.UserID(c)
+	unread, err := d.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, "Uh oh")
+	} else {
+		c.JSON(http.StatusOK, gin.H{"Unread": unread})
+	}
+}
+
+func markNotificationRead(c *gin.Context, d database.IDatabase, notificationID string) {
+	userID, _ := auth.UserID(c)
+	if err := d.MarkNotificationRead(userID, notificationID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	getUnreadNotificationCount(c, d)
+}
+
+func markAllNotificationsRead(c *gin.Context, d database.IDatabase) {
+	userID, _ := auth.UserID(c)
+	if err := d.MarkAllNotificationsRead(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	getUnreadNotificationCount(c, d)
+}
+
+func checkCredentials(c *gin.Context, d database.IDatabase) {
+	var credentials model.Credentials
+	c.BindJSON(&credentials)
+	var user model.User
+
+	user, err := d.GetUser(credentials.Username)
+	if err != nil {
+		log.WithFields(log.Fields{"username": credentials.Username}).Error("Can't find that username")
+		c.JSON(http.StatusBadRequest, gin.H{"err": "Can't find that username"})
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword(user.Password, []byte(credentials.Password))
 	if err != nil {
 		if err = d.HandlePasswordMigration(&user, &credentials); err != nil {
 			log.WithFields(log.Fields{"username": user.Username}).Error("Wrong password")
@@ -568,6 +1819,24 @@ func checkCredentials(c *gin.Context, d database.IDatabase) {
 		}
 	}
 
+	if err = policy.CanLogIn(constants.Role(user.UserRole)); err != nil {
+		log.WithFields(log.Fields{
+			"username": credentials.Username,
+		}).Error(err)
+
+		status := http.StatusUnauthorized
+		if err == policy.ErrBanned {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"err": err.Error()})
+		return
+	}
+
+	if ban, banned := activeBan(d, user.ID); banned {
+		c.JSON(http.StatusForbidden, gin.H{"err": policy.ErrBanned.Error(), "sanction": ban.Notice()})
+		return
+	}
+
 	tokenString, err := a.CreateToken(user)
 
 	if err != nil {
@@ -576,7 +1845,126 @@ func checkCredentials(c *gin.Context, d database.IDatabase) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	refreshToken, refreshHash, err := auth.NewOpaqueToken()
+	if err == nil {
+		err = d.CreateRefreshToken(user.ID, refreshHash, auth.RefreshTokenLifetime)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"err": err.Error()})
+		log.Error("Error creating the refresh token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refreshToken": refreshToken})
+}
+
+func refreshToken(c *gin.Context, d database.IDatabase) {
+	var refresh model.RefreshRequest
+	c.BindJSON(&refresh)
+
+	if refresh.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"err": "A refresh token is required"})
+		return
+	}
+
+	newToken, newHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to refresh token"})
+		return
+	}
+
+	userID, err := d.RotateRefreshToken(auth.HashOpaqueToken(refresh.RefreshToken), newHash, auth.RefreshTokenLifetime)
+	if err != nil {
+		switch err {
+		case database.ErrRefreshTokenReused:
+			// Someone is replaying an old token, so log the user out everywhere
+			log.WithFields(log.Fields{"userID": userID}).Warn(err)
+			if err = a.RevokeUserTokens(userID); err != nil {
+				log.Error(err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"err": database.ErrRefreshTokenReused.Error()})
+		case database.ErrInvalidRefreshToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"err": err.Error()})
+		default:
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to refresh token"})
+		}
+		return
+	}
+
+	user, err := d.GetUserByID(userID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": userID}).Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to refresh token"})
+		return
+	}
+
+	if err = policy.CanLogIn(constants.Role(user.UserRole)); err != nil {
+		d.RevokeUserRefreshTokens(userID)
+
+		status := http.StatusUnauthorized
+		if err == policy.ErrBanned {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"err": err.Error()})
+		return
+	}
+
+	if ban, banned := activeBan(d, user.ID); banned {
+		c.JSON(http.StatusForbidden, gin.H{"err": policy.ErrBanned.Error(), "sanction": ban.Notice()})
+		return
+	}
+
+	tokenString, err := a.CreateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"err": err.Error()})
+		log.Error("Error signing the token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refreshToken": newToken})
+}
+
+func logout(c *gin.Context, d database.IDatabase) {
+	var refresh model.RefreshRequest
+	c.BindJSON(&refresh)
+
+	if err := a.RevokeToken(c); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to log out"})
+		return
+	}
+
+	if refresh.RefreshToken != "" {
+		userID, _ := auth.UserID(c)
+		if err := d.RevokeRefreshToken(userID, auth.HashOpaqueToken(refresh.RefreshToken)); err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to log out"})
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func logoutAll(c *gin.Context, d database.IDatabase) {
+	userID, _ := auth.UserID(c)
+
+	if err := d.RevokeUserRefreshTokens(userID); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to log out"})
+		return
+	}
+
+	if err := a.RevokeUserTokens(userID); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to log out"})
+		return
+	}
+	disconnectUser(userID)
+
+	c.Status(http.StatusOK)
 }
 
 func createUser(c *gin.Context, d database.IDatabase) {
@@ -589,50 +1977,174 @@ func createUser(c *gin.Context, d database.IDatabase) {
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"err": err.Error()})
 	} else {
-		mail.SendNewUserEmail(
-			registration.EmailAddress,
-			viper.GetString(constants.BoardSendNewUserEmailSubject),
-			registration.Username,
-			fmt.Sprintf(viper.GetString(constants.BoardURLVerifyEnvVariable), id, confirmCode),
-			viper.GetString(constants.BoardURLDonateEnvVariable),
-		)
+		_, err = d.EnqueueEmail(newUserEmail(id, registration.Username, registration.EmailAddress, confirmCode))
+		if err != nil {
+			log.WithFields(log.Fields{"userID": id}).Error(err)
+		}
 		c.JSON(http.StatusCreated, id)
 	}
 }
 
 func confirmUser(c *gin.Context, d database.IDatabase, userID string, confirmCode string) {
-	confirm, err := strconv.Atoi(confirmCode)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"userID":      userID,
-			"confirmCode": confirm,
-		}).Error("Invalid confirmation code, not integer")
-
-		c.JSON(http.StatusBadRequest, confirmCode)
-	}
-	valid, err := d.ConfirmUser(userID, confirm)
+	valid, err := d.ConfirmUser(userID, confirmCode)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"userID":      userID,
-			"confirmCode": confirm,
+			"userID": userID,
 		}).Error(err)
 
-		c.JSON(http.StatusForbidden, err)
+		if err == database.ErrConfirmCodeExpired {
+			c.JSON(http.StatusGone, gin.H{"err": err.Error()})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"err": err.Error()})
+		}
 	} else {
 		if valid {
 			log.WithFields(log.Fields{
-				"userID":      userID,
-				"confirmCode": confirm,
+				"userID": userID,
 			}).Debug("Successfully confirmed user account")
 
+			publish(events.UserTopic(userID), events.UserRoleChanged, events.RoleChange{UserId: userID, Role: int(constants.User)})
+
 			c.Redirect(http.StatusTemporaryRedirect, viper.GetString(constants.BoardURLCorsEnvVariable))
 		} else {
 			log.WithFields(log.Fields{
-				"userID":      userID,
-				"confirmCode": confirm,
+				"userID": userID,
 			}).Debug("Unable to confirm user account")
 
 			c.JSON(http.StatusForbidden, valid)
 		}
 	}
 }
+
+func resendConfirmation(c *gin.Context, d database.IDatabase) {
+	var resend model.ResendConfirmation
+	c.BindJSON(&resend)
+
+	// Always give the same response so this can't be used to find out which email addresses have accounts
+	defer c.JSON(http.StatusAccepted, gin.H{"message": "If that email address has an unconfirmed account, a new confirmation link has been sent to it"})
+
+	user, err := d.GetUserByEmail(resend.EmailAddress)
+	if err != nil || user.UserRole != int(constants.NeedsConfirmation) {
+		return
+	}
+
+	confirmCode, err := d.RenewConfirmCode(user.ID, confirmResendThrottle)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Info(err)
+		return
+	}
+
+	_, err = d.EnqueueEmail(newUserEmail(user.ID, user.Username, user.EmailAddress, confirmCode))
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Error(err)
+	}
+}
+
+// newUserEmail builds the email asking a new user to confirm their account.
+func newUserEmail(userID string, userName string, emailAddress string, confirmCode string) *model.OutboxEmail {
+	return &model.OutboxEmail{
+		Template:      mail.NewUserTemplate,
+		Recipient:     emailAddress,
+		RecipientName: userName,
+		Subject:       viper.GetString(constants.BoardSendNewUserEmailSubject),
+		Data: map[string]string{
+			"BoardURLVerify": fmt.Sprintf(viper.GetString(constants.BoardURLVerifyEnvVariable), userID, confirmCode),
+			"DonateURL":      viper.GetString(constants.BoardURLDonateEnvVariable),
+		},
+	}
+}
+
+func forgotPassword(c *gin.Context, d database.IDatabase) {
+	var forgot model.ForgotPassword
+	c.BindJSON(&forgot)
+
+	// Always give the same response straight away, and send the email in the background, so neither the
+	// response nor how long it takes can be used to find out which email addresses have accounts
+	c.JSON(http.StatusAccepted, gin.H{"message": "If that email address has an account, a password reset link has been sent to it"})
+
+	go sendPasswordReset(d, forgot.EmailAddress)
+}
+
+// sendPasswordReset creates a password reset token for the user with an email address, if there is one,
+// and queues an email with a link to use it.
+func sendPasswordReset(d database.IDatabase, emailAddress string) {
+	user, err := d.GetUserByEmail(emailAddress)
+	if err != nil {
+		log.WithFields(log.Fields{"emailAddress": emailAddress}).Debug("No user found for password reset")
+		return
+	}
+
+	if user.UserRole == int(constants.Banned) {
+		log.WithFields(log.Fields{"userID": user.ID}).Info("Refusing password reset for banned user")
+		return
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = d.CreatePasswordReset(user.ID, hash, passwordResetExpiry, passwordResetThrottle)
+	if err == database.ErrPasswordResetThrottled {
+		log.WithFields(log.Fields{"userID": user.ID}).Info("Not sending another password reset so soon")
+		return
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Error(err)
+		return
+	}
+
+	_, err = d.EnqueueEmail(&model.OutboxEmail{
+		Template:      mail.PasswordResetTemplate,
+		Recipient:     user.EmailAddress,
+		RecipientName: user.Username,
+		Subject:       viper.GetString(constants.BoardSendPasswordResetSubject),
+		Data: map[string]string{
+			"BoardURLReset": fmt.Sprintf(viper.GetString(constants.BoardURLResetEnvVariable), token),
+		},
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Error(err)
+	}
+}
+
+func resetPassword(c *gin.Context, d database.IDatabase) {
+	var reset model.PasswordReset
+	c.BindJSON(&reset)
+
+	if reset.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"err": "A new password is required"})
+		return
+	}
+
+	user := model.User{}
+	if err := user.HashPassword(reset.Password); err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to set password"})
+		return
+	}
+
+	userID, err := d.ResetPassword(auth.HashOpaqueToken(reset.Token), user.Password)
+	if err != nil {
+		if err == database.ErrInvalidResetToken {
+			c.JSON(http.StatusBadRequest, gin.H{"err": err.Error()})
+		} else {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"err": "Unable to set password"})
+		}
+		return
+	}
+
+	// Anyone who knew the old password shouldn't stay logged in
+	if err = d.RevokeUserRefreshTokens(userID); err != nil {
+		log.Error(err)
+	}
+	if err = a.RevokeUserTokens(userID); err != nil {
+		log.Error(err)
+	}
+	disconnectUser(userID)
+
+	log.WithFields(log.Fields{"userID": userID}).Info("Password reset")
+	c.Status(http.StatusOK)
+}
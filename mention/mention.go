@@ -0,0 +1,102 @@
+package mention
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/DarthHater/bored-board-service/model"
+)
+
+// MaxUsers is the most distinct users a single post can mention, so a post can't be used to notify the
+// whole board.
+const MaxUsers = 20
+
+// Parse finds every @username in a post body. Code and quotes are skipped, since mentions in them are
+// usually someone else's words. Start and End are character offsets, and the usernames are as typed, so
+// they still have to be matched to users.
+func Parse(body string) []model.Mention {
+	var mentions []model.Mention
+	users := make(map[string]bool)
+
+	inFence := false
+	offset := 0
+	for _, line := range strings.SplitAfter(body, "\n") {
+		runes := []rune(line)
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inFence = !inFence
+		case inFence || strings.HasPrefix(trimmed, ">"):
+		default:
+			for _, m := range parseLine(runes, offset) {
+				name := strings.ToLower(m.UserName)
+				if !users[name] && len(users) == MaxUsers {
+					continue
+				}
+				users[name] = true
+				mentions = append(mentions, m)
+			}
+		}
+
+		offset += len(runes)
+	}
+
+	return mentions
+}
+
+func parseLine(line []rune, offset int) []model.Mention {
+	var mentions []model.Mention
+
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		if r == '`' {
+			// A backtick without a partner is just a backtick
+			if inCode || closes(line[i+1:]) {
+				inCode = !inCode
+			}
+			continue
+		}
+
+		// Something like an email address isn't a mention
+		if inCode || r != '@' || (i > 0 && isNameRune(line[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(line) && isNameRune(line[end]) {
+			end++
+		}
+		// Punctuation at the end of a sentence isn't part of the name
+		for end > i+1 && (line[end-1] == '.' || line[end-1] == '-') {
+			end--
+		}
+		if end == i+1 {
+			continue
+		}
+
+		mentions = append(mentions, model.Mention{
+			UserName: string(line[i+1 : end]),
+			Start:    offset + i,
+			End:      offset + end,
+		})
+		i = end - 1
+	}
+
+	return mentions
+}
+
+func closes(rest []rune) bool {
+	for _, r := range rest {
+		if r == '`' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
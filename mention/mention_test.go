@@ -0,0 +1,65 @@
+package mention
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	mentions := Parse("@hsimpson and @Marge.Simpson, have you seen @bart.")
+
+	assert.Equal(t, []model.Mention{
+		{UserName: "hsimpson", Start: 0, End: 9},
+		{UserName: "Marge.Simpson", Start: 14, End: 28},
+		{UserName: "bart", Start: 44, End: 49},
+	}, mentions)
+}
+
+func TestParseSkipsEmailAddresses(t *testing.T) {
+	assert.Empty(t, Parse("Write to hsimpson@springfield.org"))
+}
+
+func TestParseSkipsCode(t *testing.T) {
+	body := "Try `@decorator` here\n```\n@hsimpson\n```\nthanks @marge"
+
+	mentions := Parse(body)
+
+	assert.Len(t, mentions, 1)
+	assert.Equal(t, "marge", mentions[0].UserName)
+	assert.Equal(t, "@marge", string([]rune(body)[mentions[0].Start:mentions[0].End]))
+}
+
+func TestParseUnclosedBacktick(t *testing.T) {
+	mentions := Parse("It's a ` thing @marge")
+
+	assert.Len(t, mentions, 1)
+}
+
+func TestParseSkipsQuotes(t *testing.T) {
+	mentions := Parse("> @hsimpson said something\n@marge look")
+
+	assert.Len(t, mentions, 1)
+	assert.Equal(t, "marge", mentions[0].UserName)
+	assert.Equal(t, 27, mentions[0].Start)
+}
+
+func TestParseCountsCharacters(t *testing.T) {
+	mentions := Parse("¡Hola @marge")
+
+	assert.Equal(t, 6, mentions[0].Start)
+}
+
+func TestParseLimitsUsers(t *testing.T) {
+	var body []string
+	for i := 0; i < MaxUsers+5; i++ {
+		body = append(body, "@user"+strings.Repeat("x", i))
+	}
+	body = append(body, "@user")
+
+	mentions := Parse(strings.Join(body, " "))
+
+	assert.Len(t, mentions, MaxUsers+1)
+}
@@ -0,0 +1,3 @@
+ALTER TABLE board.user
+DROP COLUMN IF EXISTS ConfirmCodeExpiresAt,
+DROP COLUMN IF EXISTS ConfirmSentAt;
@@ -0,0 +1,7 @@
+ALTER TABLE board.user
+ADD COLUMN ConfirmCodeExpiresAt TIMESTAMP,
+ADD COLUMN ConfirmSentAt TIMESTAMP;
+
+UPDATE board.user
+SET ConfirmCodeExpiresAt = now() + interval '2 days', ConfirmSentAt = now()
+WHERE ConfirmCode IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE board.refresh_token
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    UserId UUID NOT NULL REFERENCES board.user (Id),
+    TokenHash varchar(64) NOT NULL UNIQUE,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    ExpiresAt TIMESTAMP NOT NULL,
+    RevokedAt TIMESTAMP
+);
+
+CREATE INDEX refresh_token_user_idx ON board.refresh_token (UserId);
@@ -0,0 +1,12 @@
+CREATE TABLE board.event_log
+(
+    Seq BIGSERIAL PRIMARY KEY,
+    Id UUID NOT NULL,
+    Version int NOT NULL,
+    Topic varchar(100) NOT NULL,
+    Type varchar(50) NOT NULL,
+    Payload jsonb NOT NULL DEFAULT '{}',
+    OccurredAt TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX event_log_topic_idx ON board.event_log (Topic, Seq);
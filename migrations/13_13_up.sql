@@ -0,0 +1,15 @@
+CREATE TABLE board.notification
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    UserId UUID NOT NULL REFERENCES board.user (Id),
+    Type varchar(50) NOT NULL,
+    ActorId UUID REFERENCES board.user (Id),
+    TargetId UUID,
+    PostId UUID,
+    Text text NOT NULL DEFAULT '',
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    ReadAt TIMESTAMP
+);
+
+CREATE INDEX notification_user_idx ON board.notification (UserId, CreatedAt DESC);
+CREATE INDEX notification_unread_idx ON board.notification (UserId) WHERE ReadAt IS NULL;
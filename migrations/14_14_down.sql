@@ -0,0 +1 @@
+DROP TABLE IF EXISTS board.post_mention;
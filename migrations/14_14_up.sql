@@ -0,0 +1,11 @@
+-- PostId is either a thread post or a message post
+CREATE TABLE board.post_mention
+(
+    PostId UUID NOT NULL,
+    UserId UUID NOT NULL REFERENCES board.user (Id),
+    StartOffset int NOT NULL,
+    EndOffset int NOT NULL,
+    PRIMARY KEY (PostId, StartOffset)
+);
+
+CREATE INDEX post_mention_user_idx ON board.post_mention (UserId);
@@ -0,0 +1,16 @@
+CREATE TABLE board.report
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    PostId UUID NOT NULL REFERENCES board.thread_post (Id),
+    ReporterId UUID NOT NULL REFERENCES board.user (Id),
+    Reason varchar(30) NOT NULL,
+    Details text NOT NULL DEFAULT '',
+    Status varchar(20) NOT NULL DEFAULT 'open',
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    ResolvedBy UUID REFERENCES board.user (Id),
+    ResolvedAt TIMESTAMP,
+    Resolution varchar(30) NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX report_open_idx ON board.report (PostId, ReporterId) WHERE Status = 'open';
+CREATE INDEX report_status_idx ON board.report (Status, CreatedAt DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS board.mod_log;
+DROP FUNCTION IF EXISTS board.mod_log_append_only();
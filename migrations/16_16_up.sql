@@ -0,0 +1,26 @@
+CREATE TABLE board.mod_log
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ActorId UUID NOT NULL REFERENCES board.user (Id),
+    Action varchar(50) NOT NULL,
+    TargetType varchar(20) NOT NULL,
+    TargetId UUID,
+    Reason text NOT NULL DEFAULT '',
+    Before jsonb,
+    After jsonb,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX mod_log_created_idx ON board.mod_log (CreatedAt DESC);
+CREATE INDEX mod_log_actor_idx ON board.mod_log (ActorId, CreatedAt DESC);
+CREATE INDEX mod_log_target_idx ON board.mod_log (TargetId, CreatedAt DESC);
+
+CREATE FUNCTION board.mod_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'board.mod_log is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER mod_log_append_only
+    BEFORE UPDATE OR DELETE ON board.mod_log
+    FOR EACH ROW EXECUTE PROCEDURE board.mod_log_append_only();
@@ -0,0 +1,16 @@
+CREATE TABLE board.sanction
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    UserId UUID NOT NULL REFERENCES board.user (Id),
+    Type varchar(20) NOT NULL,
+    Reason text NOT NULL DEFAULT '',
+    IssuedBy UUID NOT NULL REFERENCES board.user (Id),
+    StartsAt TIMESTAMP NOT NULL DEFAULT now(),
+    EndsAt TIMESTAMP,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    LiftedAt TIMESTAMP,
+    LiftedBy UUID REFERENCES board.user (Id)
+);
+
+CREATE INDEX sanction_user_idx ON board.sanction (UserId, CreatedAt DESC);
+CREATE INDEX sanction_expiry_idx ON board.sanction (EndsAt) WHERE LiftedAt IS NULL;
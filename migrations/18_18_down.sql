@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS board.category_permission;
+DROP TABLE IF EXISTS board.role_permission;
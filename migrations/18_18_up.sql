@@ -0,0 +1,24 @@
+CREATE TABLE board.role_permission
+(
+    Role integer NOT NULL,
+    Permission varchar(50) NOT NULL,
+    PRIMARY KEY (Role, Permission)
+);
+
+CREATE TABLE board.category_permission
+(
+    CategoryId UUID NOT NULL REFERENCES board.category (Id),
+    Role integer NOT NULL,
+    Permission varchar(50) NOT NULL,
+    Allowed boolean NOT NULL,
+    PRIMARY KEY (CategoryId, Role, Permission)
+);
+
+INSERT INTO board.role_permission (Role, Permission)
+SELECT 0, unnest(ARRAY['thread.delete', 'thread.restore', 'post.delete', 'post.restore', 'post.edit.any',
+    'user.mute', 'user.ban', 'user.role', 'report.manage', 'category.manage', 'modlog.view', 'email.manage',
+    'permission.manage']);
+
+INSERT INTO board.role_permission (Role, Permission)
+SELECT 1, unnest(ARRAY['thread.delete', 'thread.restore', 'post.delete', 'post.restore', 'post.edit.any',
+    'user.mute', 'user.ban', 'user.role', 'report.manage']);
@@ -0,0 +1,7 @@
+-- Permission changes store a role ID as their target, which can't be a UUID
+ALTER TABLE board.mod_log DISABLE TRIGGER mod_log_append_only;
+UPDATE board.mod_log SET TargetId = NULL
+    WHERE TargetId !~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+ALTER TABLE board.mod_log ENABLE TRIGGER mod_log_append_only;
+
+ALTER TABLE board.mod_log ALTER COLUMN TargetId TYPE UUID USING TargetId::uuid;
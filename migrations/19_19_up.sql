@@ -0,0 +1 @@
+ALTER TABLE board.mod_log ALTER COLUMN TargetId TYPE varchar(50) USING TargetId::text;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS board.thread_post_paging_idx;
@@ -0,0 +1 @@
+CREATE INDEX thread_post_paging_idx ON board.thread_post (ThreadId, PostedAt, Id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS board.thread_category_idx;
+
+ALTER TABLE board.thread
+DROP COLUMN IF EXISTS CategoryId;
+
+DROP TABLE IF EXISTS board.category;
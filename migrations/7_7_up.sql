@@ -0,0 +1,26 @@
+CREATE TABLE board.category
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    Title varchar(250) NOT NULL,
+    Description text NOT NULL DEFAULT '',
+    SortOrder int NOT NULL DEFAULT 0,
+    RequiredRole int NOT NULL DEFAULT 3,
+    IsDefault boolean NOT NULL DEFAULT false,
+    Archived boolean NOT NULL DEFAULT false
+);
+
+CREATE UNIQUE INDEX category_default_idx ON board.category (IsDefault) WHERE IsDefault;
+
+INSERT INTO board.category (Title, Description, SortOrder, IsDefault) VALUES
+    ('General', 'Anything and everything', 0, true);
+
+ALTER TABLE board.thread
+ADD COLUMN CategoryId UUID REFERENCES board.category (Id);
+
+UPDATE board.thread
+SET CategoryId = (SELECT Id FROM board.category WHERE IsDefault);
+
+ALTER TABLE board.thread
+ALTER COLUMN CategoryId SET NOT NULL;
+
+CREATE INDEX thread_category_idx ON board.thread (CategoryId, LastPostedAt);
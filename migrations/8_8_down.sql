@@ -0,0 +1 @@
+DROP TABLE IF EXISTS board.password_reset;
@@ -0,0 +1,11 @@
+CREATE TABLE board.password_reset
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    UserId UUID NOT NULL REFERENCES board.user (Id),
+    TokenHash varchar(64) NOT NULL UNIQUE,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    ExpiresAt TIMESTAMP NOT NULL,
+    UsedAt TIMESTAMP
+);
+
+CREATE INDEX password_reset_user_idx ON board.password_reset (UserId);
@@ -0,0 +1,17 @@
+CREATE TABLE board.email_outbox
+(
+    Id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    Template varchar(100) NOT NULL,
+    Recipient varchar(250) NOT NULL,
+    RecipientName varchar(250) NOT NULL DEFAULT '',
+    Subject varchar(250) NOT NULL DEFAULT '',
+    Data jsonb NOT NULL DEFAULT '{}',
+    Status varchar(20) NOT NULL DEFAULT 'pending',
+    Attempts int NOT NULL DEFAULT 0,
+    LastError text NOT NULL DEFAULT '',
+    NextAttemptAt TIMESTAMP NOT NULL DEFAULT now(),
+    CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+    SentAt TIMESTAMP
+);
+
+CREATE INDEX email_outbox_due_idx ON board.email_outbox (Status, NextAttemptAt);
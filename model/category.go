@@ -0,0 +1,12 @@
+package model
+
+// Category groups threads into a subforum. Only users whose role grants access to RequiredRole can see it.
+type Category struct {
+	Id           string
+	Title        string
+	Description  string
+	SortOrder    int
+	RequiredRole int
+	IsDefault    bool
+	Archived     bool
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor occurs when a pagination cursor can't be decoded
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// PostCursor marks a position in a thread, using the PostedAt time and Id of a post as a keyset.
+type PostCursor struct {
+	PostedAt string
+	Id       string
+}
+
+// Encode returns an opaque, URL safe representation of the cursor.
+func (c PostCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.PostedAt + "|" + c.Id))
+}
+
+// DecodePostCursor will parse a cursor previously created by Encode.
+func DecodePostCursor(s string) (cursor PostCursor, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(decoded), "|", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return cursor, ErrInvalidCursor
+	}
+
+	return PostCursor{PostedAt: parts[0], Id: parts[1]}, nil
+}
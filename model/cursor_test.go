@@ -0,0 +1,24 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostCursorRoundTrip(t *testing.T) {
+	c := PostCursor{PostedAt: "2018-06-01T10:00:00.123456Z", Id: "7a3c9d2e-0000-0000-0000-000000000000"}
+
+	decoded, err := DecodePostCursor(c.Encode())
+
+	assert.Nil(t, err)
+	assert.Equal(t, c, decoded)
+}
+
+func TestDecodePostCursorInvalid(t *testing.T) {
+	_, err := DecodePostCursor("not a cursor!")
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	_, err = DecodePostCursor(PostCursor{PostedAt: "A time"}.Encode())
+	assert.Equal(t, ErrInvalidCursor, err)
+}
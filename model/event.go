@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Event is the envelope every real-time update is sent to clients in. Seq orders events in the event
+// log, and is what clients send back as Last-Event-ID to catch up on events they missed.
+type Event struct {
+	Version    int         `json:"version"`
+	Type       string      `json:"type"`
+	Id         string      `json:"id"`
+	Seq        int64       `json:"seq"`
+	Topic      string      `json:"topic"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Payload    interface{} `json:"payload"`
+}
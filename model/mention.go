@@ -0,0 +1,10 @@
+package model
+
+// Mention is an @username in the body of a post. Start and End are the character offsets of the whole
+// "@username", so clients can link it to the user.
+type Mention struct {
+	UserId   string
+	UserName string
+	Start    int
+	End      int
+}
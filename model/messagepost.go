@@ -7,4 +7,5 @@ type MessagePost struct {
 	Body      string
 	PostedAt  string
 	UserName  string
+	Mentions  []Mention `json:",omitempty"`
 }
@@ -0,0 +1,36 @@
+package model
+
+// ModLogEntry records a privileged action: who did it, what they did it to and why, along with snapshots
+// of the target before and after. TargetRequiredRole is the role needed to see the target, for threads,
+// posts and categories in restricted categories.
+type ModLogEntry struct {
+	Id                 string
+	ActorId            string
+	ActorName          string
+	Action             string
+	TargetType         string
+	TargetId           string
+	TargetRequiredRole int `json:"-"`
+	Reason             string
+	Before             interface{}
+	After              interface{}
+	CreatedAt          string
+}
+
+// ModLogFilter narrows down the mod log. Empty fields match everything.
+type ModLogFilter struct {
+	Action     string
+	ActorId    string
+	TargetType string
+	TargetId   string
+	Limit      int
+}
+
+// PublicModAction is a mod log entry without who did it or the snapshots, for anyone to see.
+type PublicModAction struct {
+	Action     string
+	TargetType string
+	TargetId   string
+	Reason     string
+	CreatedAt  string
+}
@@ -0,0 +1,22 @@
+package model
+
+// Notification tells a user about something that happened that involves them. TargetId is the thread or
+// message it's about, and PostId the post within it, when there is one.
+type Notification struct {
+	Id        string
+	UserId    string
+	Type      string
+	ActorId   string
+	ActorName string
+	TargetId  string
+	PostId    string
+	Text      string
+	CreatedAt string
+	ReadAt    *string
+}
+
+// NotificationPage is a page of a user's notifications along with how many they haven't read.
+type NotificationPage struct {
+	Notifications []Notification
+	Unread        int
+}
@@ -0,0 +1,7 @@
+package model
+
+// OnlineUser is a user with at least one socket or event stream open.
+type OnlineUser struct {
+	UserId   string
+	UserName string
+}
@@ -0,0 +1,17 @@
+package model
+
+// OutboxEmail is an email waiting to be sent, or a record of one that was.
+type OutboxEmail struct {
+	Id            string
+	Template      string
+	Recipient     string
+	RecipientName string
+	Subject       string
+	Data          map[string]string `json:"-"`
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt string
+	CreatedAt     string
+	SentAt        *string
+}
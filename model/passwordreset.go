@@ -0,0 +1,12 @@
+package model
+
+// ForgotPassword is sent by a user who wants a password reset email.
+type ForgotPassword struct {
+	EmailAddress string
+}
+
+// PasswordReset is sent by a user to set a new password using the token from their reset email.
+type PasswordReset struct {
+	Token    string
+	Password string
+}
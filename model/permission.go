@@ -0,0 +1,15 @@
+package model
+
+// RolePermissions are the permissions a role has everywhere on the board.
+type RolePermissions struct {
+	Role        int
+	RoleName    string
+	Permissions []string
+}
+
+// CategoryPermission grants a role a permission in one category, or takes it away when Allowed is false.
+type CategoryPermission struct {
+	Role       int
+	Permission string
+	Allowed    bool
+}
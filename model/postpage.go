@@ -0,0 +1,17 @@
+package model
+
+// PostPageRequest describes which page of posts in a thread to load. At most one of After, Before
+// or Around should be set; if none are, the first page is returned.
+type PostPageRequest struct {
+	After  string
+	Before string
+	Around string
+	Limit  int
+}
+
+// PostPage is a single page of posts along with cursors for the neighbouring pages.
+type PostPage struct {
+	Posts      []Post
+	NextCursor string
+	PrevCursor string
+}
@@ -0,0 +1,6 @@
+package model
+
+// RefreshRequest is sent by a user to swap a refresh token for a new access token, or to revoke it on logout.
+type RefreshRequest struct {
+	RefreshToken string
+}
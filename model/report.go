@@ -0,0 +1,31 @@
+package model
+
+// Report is a user flagging a post for the mods to look at.
+type Report struct {
+	Id             string
+	PostId         string
+	ReporterId     string
+	ReporterName   string
+	Reason         string
+	Details        string
+	Status         string
+	CreatedAt      string
+	ResolvedBy     string
+	ResolvedByName string
+	ResolvedAt     *string
+	Resolution     string
+}
+
+// ReportedPost is a post in the mod queue along with the reports made about it, newest first.
+type ReportedPost struct {
+	Post    Post
+	Reports []Report
+}
+
+// ReportResolution is how a mod resolves the reports about a post. Muting or banning the author issues
+// a sanction lasting Hours, or until it's lifted when Hours is 0, and the author is told the Reason.
+type ReportResolution struct {
+	Action string
+	Reason string
+	Hours  int
+}
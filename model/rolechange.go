@@ -0,0 +1,6 @@
+package model
+
+// RoleChangeRequest is sent by an admin or mod to give a user a new role.
+type RoleChangeRequest struct {
+	Role int
+}
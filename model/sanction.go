@@ -0,0 +1,36 @@
+package model
+
+// Sanction mutes or bans a user for a while, without touching their role. A sanction without an EndsAt
+// lasts until it's lifted.
+type Sanction struct {
+	Id           string
+	UserId       string
+	Type         string
+	Reason       string
+	IssuedBy     string
+	IssuedByName string
+	StartsAt     string
+	EndsAt       *string
+	CreatedAt    string
+	LiftedAt     *string
+	LiftedBy     string
+}
+
+// NewSanction is sent by a mod to sanction a user. Hours is how long it lasts, or 0 for until it's lifted.
+type NewSanction struct {
+	Type   string
+	Reason string
+	Hours  int
+}
+
+// SanctionNotice is what a sanctioned user is told when a request is rejected because of a sanction.
+type SanctionNotice struct {
+	Type   string
+	Reason string
+	EndsAt *string
+}
+
+// Notice returns what the sanctioned user should be told about the sanction.
+func (s Sanction) Notice() SanctionNotice {
+	return SanctionNotice{Type: s.Type, Reason: s.Reason, EndsAt: s.EndsAt}
+}
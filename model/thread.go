@@ -7,4 +7,5 @@ type Thread struct {
 	PostedAt     string
 	UserName     string
 	LastPostedAt string
+	CategoryId   string
 }
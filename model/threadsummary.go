@@ -0,0 +1,17 @@
+package model
+
+// ThreadSummary is everything the thread index needs to show a thread, sent when a thread is created or
+// bumped so the index can update without reloading.
+type ThreadSummary struct {
+	Id             string
+	Title          string
+	UserId         string
+	UserName       string
+	CategoryId     string
+	RequiredRole   int `json:"-"`
+	PostedAt       string
+	LastPostedAt   string
+	ReplyCount     int
+	LastPosterId   string
+	LastPosterName string
+}
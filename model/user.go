@@ -24,6 +24,11 @@ type Registration struct {
 	Password     string
 }
 
+// ResendConfirmation is sent by a user who needs a new account confirmation email.
+type ResendConfirmation struct {
+	EmailAddress string
+}
+
 // HashPassword with return a bcrypt hash of a string.
 func (u *User) HashPassword(password string) (err error) {
 	u.Password, err = bcrypt.GenerateFromPassword([]byte(password), 8)
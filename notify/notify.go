@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/events"
+	"github.com/DarthHater/bored-board-service/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Notifier creates notifications for the users something involves, and sends each one to the user's own
+// topic so clients that are connected see it straight away.
+type Notifier struct {
+	DB        database.IDatabase
+	Publisher events.Publisher
+}
+
+// NewNotifier creates a notifier that saves notifications to the database and publishes them.
+func NewNotifier(d database.IDatabase, p events.Publisher) *Notifier {
+	return &Notifier{DB: d, Publisher: p}
+}
+
+// Reply lets the user who started a thread know someone replied to it.
+func (n *Notifier) Reply(post model.Post) {
+	thread, err := n.DB.GetThread(post.ThreadId)
+	if err != nil {
+		log.WithFields(log.Fields{"threadID": post.ThreadId, "error": err}).Error("Error finding thread to notify")
+		return
+	}
+
+	if thread.UserId == post.UserId {
+		return
+	}
+
+	n.Notify(&model.Notification{
+		UserId:   thread.UserId,
+		Type:     string(constants.NotificationReply),
+		ActorId:  post.UserId,
+		TargetId: post.ThreadId,
+		PostId:   post.Id,
+		Text:     thread.Title,
+	})
+}
+
+// Message lets everyone in a message other than the sender know there's something new in it.
+func (n *Notifier) Message(messageID string, senderID string) {
+	message, err := n.DB.GetMessage(messageID)
+	if err != nil {
+		log.WithFields(log.Fields{"messageID": messageID, "error": err}).Error("Error finding message to notify")
+		return
+	}
+
+	members, err := n.DB.GetMessageMemberIDs(messageID)
+	if err != nil {
+		log.WithFields(log.Fields{"messageID": messageID, "error": err}).Error("Error finding message members to notify")
+		return
+	}
+
+	for _, userID := range members {
+		if userID == senderID {
+			continue
+		}
+
+		n.Notify(&model.Notification{
+			UserId:   userID,
+			Type:     string(constants.NotificationMessage),
+			ActorId:  senderID,
+			TargetId: messageID,
+			Text:     message.Title,
+		})
+	}
+}
+
+// Mention lets a user know they were mentioned in a post in a thread or message. Whoever calls this
+// should check the user can see the post.
+func (n *Notifier) Mention(userID string, actorID string, targetID string, postID string) {
+	if userID == actorID {
+		return
+	}
+
+	n.Notify(&model.Notification{
+		UserId:   userID,
+		Type:     string(constants.NotificationMention),
+		ActorId:  actorID,
+		TargetId: targetID,
+		PostId:   postID,
+	})
+}
+
+// ModAction lets a user know a moderator did something to them or their posts. The text describes what
+// was done.
+func (n *Notifier) ModAction(userID string, modID string, targetID string, text string) {
+	n.Notify(&model.Notification{
+		UserId:   userID,
+		Type:     string(constants.NotificationModAction),
+		ActorId:  modID,
+		TargetId: targetID,
+		Text:     text,
+	})
+}
+
+// Notify saves a notification and publishes it to its user. Failing to notify someone is logged rather
+// than returned, since it shouldn't fail whatever caused it.
+func (n *Notifier) Notify(notification *model.Notification) {
+	if err := n.DB.CreateNotification(notification); err != nil {
+		log.WithFields(log.Fields{"userID": notification.UserId, "type": notification.Type, "error": err}).
+			Error("Error creating notification")
+		return
+	}
+
+	err := n.Publisher.Publish(events.UserTopic(notification.UserId), events.NotificationCreated, notification)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": notification.UserId, "error": err}).Error("Error publishing notification")
+	}
+}
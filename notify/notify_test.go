@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/events"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDatabase struct {
+	database.IDatabase
+	thread        model.Thread
+	message       model.Message
+	members       []string
+	notifications []model.Notification
+}
+
+func (f *fakeDatabase) GetThread(threadID string) (model.Thread, error) {
+	return f.thread, nil
+}
+
+func (f *fakeDatabase) GetMessage(messageID string) (model.Message, error) {
+	return f.message, nil
+}
+
+func (f *fakeDatabase) GetMessageMemberIDs(messageID string) ([]string, error) {
+	return f.members, nil
+}
+
+func (f *fakeDatabase) CreateNotification(n *model.Notification) error {
+	n.Id = "notification"
+	f.notifications = append(f.notifications, *n)
+	return nil
+}
+
+type published struct {
+	topic     string
+	eventType events.Type
+}
+
+type fakePublisher struct {
+	published []published
+}
+
+func (f *fakePublisher) Publish(topic string, eventType events.Type, payload interface{}) error {
+	f.published = append(f.published, published{topic, eventType})
+	return nil
+}
+
+func (f *fakePublisher) PublishEphemeral(topic string, eventType events.Type, payload interface{}) error {
+	return nil
+}
+
+func TestReply(t *testing.T) {
+	d := &fakeDatabase{thread: model.Thread{Id: "thread", UserId: "author", Title: "Woof"}}
+	p := &fakePublisher{}
+	n := NewNotifier(d, p)
+
+	n.Reply(model.Post{Id: "post", ThreadId: "thread", UserId: "replier"})
+
+	assert.Len(t, d.notifications, 1)
+	assert.Equal(t, "author", d.notifications[0].UserId)
+	assert.Equal(t, string(constants.NotificationReply), d.notifications[0].Type)
+	assert.Equal(t, "Woof", d.notifications[0].Text)
+	assert.Equal(t, []published{{"user:author", events.NotificationCreated}}, p.published)
+}
+
+func TestReplyToOwnThread(t *testing.T) {
+	d := &fakeDatabase{thread: model.Thread{Id: "thread", UserId: "author"}}
+	p := &fakePublisher{}
+	n := NewNotifier(d, p)
+
+	n.Reply(model.Post{Id: "post", ThreadId: "thread", UserId: "author"})
+
+	assert.Empty(t, d.notifications)
+	assert.Empty(t, p.published)
+}
+
+func TestMessage(t *testing.T) {
+	d := &fakeDatabase{message: model.Message{Id: "message", Title: "Hello"}, members: []string{"sender", "a", "b"}}
+	p := &fakePublisher{}
+	n := NewNotifier(d, p)
+
+	n.Message("message", "sender")
+
+	assert.Len(t, d.notifications, 2)
+	assert.Equal(t, "a", d.notifications[0].UserId)
+	assert.Equal(t, "b", d.notifications[1].UserId)
+	assert.Equal(t, "message", d.notifications[1].TargetId)
+	assert.Equal(t, "Hello", d.notifications[1].Text)
+}
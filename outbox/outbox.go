@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/mail"
+	"github.com/DarthHater/bored-board-service/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultInterval is how often the worker checks the outbox for emails that are due.
+	DefaultInterval = 10 * time.Second
+	// DefaultBatchSize is the most emails the worker will claim at once.
+	DefaultBatchSize = 20
+	// DefaultMaxAttempts is how many times an email is tried before it's marked dead.
+	DefaultMaxAttempts = 8
+
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 2 * time.Hour
+	lease       = 5 * time.Minute
+)
+
+// Worker delivers emails from the outbox, retrying failures with exponential backoff.
+type Worker struct {
+	DB          database.IDatabase
+	Send        func(e model.OutboxEmail) error
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+}
+
+// NewWorker creates a worker that sends emails with the mail package using the default settings.
+func NewWorker(d database.IDatabase) *Worker {
+	return &Worker{
+		DB: d,
+		Send: func(e model.OutboxEmail) error {
+			return mail.Send(e.Template, e.Recipient, e.RecipientName, e.Subject, e.Data)
+		},
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+	}
+}
+
+// Start delivers due emails every interval, forever.
+func (w *Worker) Start() {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.DeliverDue()
+		<-ticker.C
+	}
+}
+
+// DeliverDue claims a batch of due emails and tries to send each of them.
+func (w *Worker) DeliverDue() {
+	emails, err := w.DB.ClaimOutboxEmails(w.BatchSize, lease)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Error claiming emails from the outbox")
+		return
+	}
+
+	for _, e := range emails {
+		w.deliver(e)
+	}
+}
+
+func (w *Worker) deliver(e model.OutboxEmail) {
+	err := w.Send(e)
+	if err == nil {
+		if err = w.DB.MarkEmailSent(e.Id); err != nil {
+			log.WithFields(log.Fields{"emailID": e.Id, "error": err}).Error("Error marking email as sent")
+		}
+		return
+	}
+
+	dead := e.Attempts >= w.MaxAttempts
+	fields := log.Fields{
+		"emailID":  e.Id,
+		"template": e.Template,
+		"attempts": e.Attempts,
+		"error":    err,
+	}
+	if dead {
+		log.WithFields(fields).Error("Giving up on sending email")
+	} else {
+		log.WithFields(fields).Warn("Error sending email, will retry")
+	}
+
+	if err = w.DB.MarkEmailFailed(e.Id, err.Error(), Backoff(e.Attempts), dead); err != nil {
+		log.WithFields(log.Fields{"emailID": e.Id, "error": err}).Error("Error recording email failure")
+	}
+}
+
+// Backoff returns how long to wait before the next attempt, doubling after every failed attempt.
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return backoff
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type failure struct {
+	reason string
+	dead   bool
+}
+
+type fakeDatabase struct {
+	database.IDatabase
+	emails   []model.OutboxEmail
+	sent     []string
+	failures map[string]failure
+}
+
+func (f *fakeDatabase) ClaimOutboxEmails(limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	return f.emails, nil
+}
+
+func (f *fakeDatabase) MarkEmailSent(id string) error {
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeDatabase) MarkEmailFailed(id string, reason string, retryIn time.Duration, dead bool) error {
+	f.failures[id] = failure{reason, dead}
+	return nil
+}
+
+func TestDeliverDue(t *testing.T) {
+	d := &fakeDatabase{
+		emails: []model.OutboxEmail{
+			{Id: "ok", Attempts: 1},
+			{Id: "retry", Attempts: 1},
+			{Id: "dead", Attempts: 3},
+		},
+		failures: map[string]failure{},
+	}
+	w := &Worker{
+		DB: d,
+		Send: func(e model.OutboxEmail) error {
+			if e.Id == "ok" {
+				return nil
+			}
+			return errors.New("SendGrid is down")
+		},
+		BatchSize:   10,
+		MaxAttempts: 3,
+	}
+
+	w.DeliverDue()
+
+	assert.Equal(t, []string{"ok"}, d.sent)
+	assert.Equal(t, failure{"SendGrid is down", false}, d.failures["retry"])
+	assert.Equal(t, failure{"SendGrid is down", true}, d.failures["dead"])
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 2*time.Hour, Backoff(20))
+}
@@ -0,0 +1,102 @@
+package policy
+
+import (
+	"errors"
+
+	"github.com/DarthHater/bored-board-service/constants"
+)
+
+// ErrNeedsConfirmation occurs when a user hasn't confirmed their email address yet
+var ErrNeedsConfirmation = errors.New("User account needs verified")
+
+// ErrBanned occurs when a banned user tries to use the board
+var ErrBanned = errors.New("User account has been banned")
+
+// ErrMuted occurs when a muted user tries to create content
+var ErrMuted = errors.New("User account has been muted")
+
+// ErrOutranked occurs when a user tries to moderate someone whose role is the same as or above their own
+var ErrOutranked = errors.New("User can't moderate someone with the same or a higher role")
+
+// ErrRoleNotAssignable occurs when a user tries to give someone a role they aren't allowed to give
+var ErrRoleNotAssignable = errors.New("User can't assign that role")
+
+// ErrUseSanction occurs when a user tries to mute or ban someone by changing their role
+var ErrUseSanction = errors.New("Mute or ban users with a sanction at /user/:userid/sanction instead")
+
+// CanLogIn returns an error explaining why a user with the given role isn't allowed to log in.
+func CanLogIn(role constants.Role) error {
+	return CanRead(role)
+}
+
+// CanRead returns an error explaining why a user with the given role isn't allowed to read the board.
+func CanRead(role constants.Role) error {
+	switch role {
+	case constants.NeedsConfirmation:
+		return ErrNeedsConfirmation
+	case constants.Banned:
+		return ErrBanned
+	}
+
+	return nil
+}
+
+// CanWrite returns an error explaining why a user with the given role isn't allowed to create or edit
+// threads, posts and messages.
+func CanWrite(role constants.Role) error {
+	if err := CanRead(role); err != nil {
+		return err
+	}
+
+	if role == constants.Muted {
+		return ErrMuted
+	}
+
+	return nil
+}
+
+// CanModerate returns an error explaining why a user with the given role isn't allowed to sanction or
+// change the role of a user with the target role. Whether the role can moderate anyone at all is up to its
+// permissions, but nobody can moderate someone with the same or a higher role, so only Admins can
+// moderate Mods and nobody can moderate an Admin.
+func CanModerate(role constants.Role, target constants.Role) error {
+	if target <= role {
+		return ErrOutranked
+	}
+
+	return nil
+}
+
+// CanAssignRole returns an error explaining why a user with the given role isn't allowed to change a
+// user's role from one role to another. Admins can assign any role from Admin to User, while other roles can
+// only give users below them back the User role, such as users muted or banned before sanctions replaced
+// those roles.
+// Nobody can give the Muted or Banned roles, since sanctions do that without losing the user's role.
+func CanAssignRole(role constants.Role, from constants.Role, to constants.Role) error {
+	if to == constants.Muted || to == constants.Banned {
+		return ErrUseSanction
+	}
+
+	if to < constants.Admin || to > constants.User {
+		return ErrRoleNotAssignable
+	}
+
+	if role == constants.Admin {
+		return nil
+	}
+
+	if err := CanModerate(role, from); err != nil {
+		return err
+	}
+
+	if to != constants.User {
+		return ErrRoleNotAssignable
+	}
+
+	// Only admins can let in someone who hasn't confirmed their account
+	if from == constants.NeedsConfirmation {
+		return ErrRoleNotAssignable
+	}
+
+	return nil
+}
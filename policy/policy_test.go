@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanLogIn(t *testing.T) {
+	assert.Nil(t, CanLogIn(constants.Admin))
+	assert.Nil(t, CanLogIn(constants.User))
+	assert.Nil(t, CanLogIn(constants.Muted))
+	assert.Equal(t, ErrBanned, CanLogIn(constants.Banned))
+	assert.Equal(t, ErrNeedsConfirmation, CanLogIn(constants.NeedsConfirmation))
+}
+
+func TestCanWrite(t *testing.T) {
+	assert.Nil(t, CanWrite(constants.Mod))
+	assert.Nil(t, CanWrite(constants.Elite))
+	assert.Nil(t, CanWrite(constants.User))
+	assert.Equal(t, ErrMuted, CanWrite(constants.Muted))
+	assert.Equal(t, ErrBanned, CanWrite(constants.Banned))
+}
+
+func TestCanModerate(t *testing.T) {
+	assert.Nil(t, CanModerate(constants.Admin, constants.Mod))
+	assert.Nil(t, CanModerate(constants.Mod, constants.User))
+	assert.Nil(t, CanModerate(constants.Mod, constants.Banned))
+	assert.Equal(t, ErrOutranked, CanModerate(constants.Mod, constants.Mod))
+	assert.Equal(t, ErrOutranked, CanModerate(constants.Mod, constants.Admin))
+	assert.Equal(t, ErrOutranked, CanModerate(constants.Admin, constants.Admin))
+	assert.Nil(t, CanModerate(constants.Elite, constants.Muted))
+	assert.Equal(t, ErrOutranked, CanModerate(constants.User, constants.User))
+}
+
+func TestCanAssignRole(t *testing.T) {
+	assert.Nil(t, CanAssignRole(constants.Admin, constants.User, constants.Admin))
+	assert.Nil(t, CanAssignRole(constants.Admin, constants.Admin, constants.Mod))
+	assert.Nil(t, CanAssignRole(constants.Mod, constants.Muted, constants.User))
+	assert.Nil(t, CanAssignRole(constants.Mod, constants.Banned, constants.User))
+	assert.Equal(t, ErrUseSanction, CanAssignRole(constants.Mod, constants.User, constants.Muted))
+	assert.Equal(t, ErrUseSanction, CanAssignRole(constants.Admin, constants.Elite, constants.Banned))
+	assert.Equal(t, ErrRoleNotAssignable, CanAssignRole(constants.Mod, constants.User, constants.Admin))
+	assert.Equal(t, ErrRoleNotAssignable, CanAssignRole(constants.Mod, constants.User, constants.Elite))
+	assert.Equal(t, ErrRoleNotAssignable, CanAssignRole(constants.Mod, constants.NeedsConfirmation, constants.User))
+	assert.Equal(t, ErrRoleNotAssignable, CanAssignRole(constants.Admin, constants.User, constants.NeedsConfirmation))
+	assert.Equal(t, ErrOutranked, CanAssignRole(constants.Mod, constants.Mod, constants.User))
+	assert.Equal(t, ErrOutranked, CanAssignRole(constants.User, constants.User, constants.User))
+}
@@ -0,0 +1,239 @@
+package presence
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/broker"
+	"github.com/DarthHater/bored-board-service/model"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Topic is the broker topic servers share presence on. Clients never see it.
+	Topic = "_presence"
+	// HeartbeatInterval is how often each server announces who is connected to it.
+	HeartbeatInterval = 20 * time.Second
+	// Expiry is how long a server's users are kept after its last heartbeat, in case it went away
+	// without saying goodbye.
+	Expiry = 3 * HeartbeatInterval
+)
+
+const (
+	kindHeartbeat = "heartbeat"
+	kindJoin      = "join"
+	kindLeave     = "leave"
+)
+
+// announcement is what servers publish to each other about the users connected to them.
+type announcement struct {
+	ServerId string
+	Kind     string
+	Users    []model.OnlineUser
+}
+
+type server struct {
+	users map[string]model.OnlineUser
+	seen  time.Time
+}
+
+type localUser struct {
+	user        model.OnlineUser
+	connections int
+}
+
+// Tracker keeps track of which users are online across every server sharing a broker.
+type Tracker struct {
+	// OnChange is called when a user comes online on their first server, or goes offline on their last.
+	OnChange func(user model.OnlineUser, online bool)
+
+	id      string
+	broker  broker.Broker
+	mu      sync.Mutex
+	local   map[string]*localUser
+	servers map[string]*server
+}
+
+// NewTracker creates a tracker for this server that shares presence through the broker.
+func NewTracker(b broker.Broker) *Tracker {
+	return &Tracker{
+		id:      uuid.NewV4().String(),
+		broker:  b,
+		local:   make(map[string]*localUser),
+		servers: make(map[string]*server),
+	}
+}
+
+// Start announces this server's users and listens for other servers' announcements until the broker is
+// closed.
+func (t *Tracker) Start() {
+	go t.heartbeat()
+
+	backoff := time.Second
+	for {
+		err := t.broker.Subscribe([]string{Topic}, t.receive)
+		if err == broker.ErrClosed {
+			return
+		}
+		log.WithFields(log.Fields{"error": err}).Warn("Lost the presence subscription, resubscribing")
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > HeartbeatInterval {
+			backoff = HeartbeatInterval
+		}
+	}
+}
+
+// Connect records that a user opened a connection to this server.
+func (t *Tracker) Connect(user model.OnlineUser) {
+	t.mu.Lock()
+	l, ok := t.local[user.UserId]
+	if !ok {
+		l = &localUser{user: user}
+		t.local[user.UserId] = l
+	}
+	l.connections++
+	first := l.connections == 1
+	t.mu.Unlock()
+
+	if first {
+		t.announce(kindJoin, []model.OnlineUser{user})
+	}
+}
+
+// Disconnect records that a user closed a connection to this server.
+func (t *Tracker) Disconnect(userID string) {
+	t.mu.Lock()
+	l, ok := t.local[userID]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	l.connections--
+	last := l.connections == 0
+	if last {
+		delete(t.local, userID)
+	}
+	t.mu.Unlock()
+
+	if last {
+		t.announce(kindLeave, []model.OnlineUser{l.user})
+	}
+}
+
+// Online lists every user connected to any server, ordered by name.
+func (t *Tracker) Online() []model.OnlineUser {
+	t.mu.Lock()
+	online := t.online()
+	t.mu.Unlock()
+
+	users := make([]model.OnlineUser, 0, len(online))
+	for _, user := range online {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+
+	return users
+}
+
+func (t *Tracker) heartbeat() {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.mu.Lock()
+		users := make([]model.OnlineUser, 0, len(t.local))
+		for _, l := range t.local {
+			users = append(users, l.user)
+		}
+		t.mu.Unlock()
+
+		t.announce(kindHeartbeat, users)
+		t.expire(time.Now())
+	}
+}
+
+func (t *Tracker) announce(kind string, users []model.OnlineUser) {
+	bytes, err := json.Marshal(announcement{ServerId: t.id, Kind: kind, Users: users})
+	if err != nil {
+		return
+	}
+
+	if err = t.broker.Publish(Topic, bytes); err != nil {
+		log.WithFields(log.Fields{"kind": kind}).Error(err)
+	}
+}
+
+func (t *Tracker) receive(m broker.Message) {
+	var a announcement
+	if err := json.Unmarshal(m.Data, &a); err != nil {
+		log.Error(err)
+		return
+	}
+
+	t.update(func() {
+		s, ok := t.servers[a.ServerId]
+		if !ok || a.Kind == kindHeartbeat {
+			s = &server{users: make(map[string]model.OnlineUser)}
+			t.servers[a.ServerId] = s
+		}
+		s.seen = time.Now()
+
+		for _, user := range a.Users {
+			if a.Kind == kindLeave {
+				delete(s.users, user.UserId)
+			} else {
+				s.users[user.UserId] = user
+			}
+		}
+	})
+}
+
+// expire forgets the users of servers that stopped sending heartbeats.
+func (t *Tracker) expire(now time.Time) {
+	t.update(func() {
+		for id, s := range t.servers {
+			if now.Sub(s.seen) > Expiry {
+				delete(t.servers, id)
+			}
+		}
+	})
+}
+
+// update applies a change to the servers and lets OnChange know about anyone who came online or went
+// offline because of it.
+func (t *Tracker) update(change func()) {
+	t.mu.Lock()
+	before := t.online()
+	change()
+	after := t.online()
+	t.mu.Unlock()
+
+	if t.OnChange == nil {
+		return
+	}
+	for id, user := range after {
+		if _, ok := before[id]; !ok {
+			t.OnChange(user, true)
+		}
+	}
+	for id, user := range before {
+		if _, ok := after[id]; !ok {
+			t.OnChange(user, false)
+		}
+	}
+}
+
+// online is every user connected to any server. Callers must hold the lock.
+func (t *Tracker) online() map[string]model.OnlineUser {
+	online := make(map[string]model.OnlineUser)
+	for _, s := range t.servers {
+		for id, user := range s.users {
+			online[id] = user
+		}
+	}
+	return online
+}
@@ -0,0 +1,70 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/broker"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventually(t *testing.T, condition func() bool) {
+	for i := 0; i < 200; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Condition was never met")
+}
+
+func TestTrackerSharesPresenceBetweenServers(t *testing.T) {
+	b := broker.NewMemoryBroker()
+	defer b.Close()
+
+	first := NewTracker(b)
+	second := NewTracker(b)
+
+	changes := make(chan bool, 10)
+	second.OnChange = func(user model.OnlineUser, online bool) {
+		changes <- online
+	}
+
+	go first.Start()
+	go second.Start()
+	eventually(t, func() bool {
+		b.Publish(Topic, []byte(`{"ServerId":"warmup","Kind":"heartbeat"}`))
+		first.mu.Lock()
+		defer first.mu.Unlock()
+		second.mu.Lock()
+		defer second.mu.Unlock()
+		return first.servers["warmup"] != nil && second.servers["warmup"] != nil
+	})
+
+	homer := model.OnlineUser{UserId: "1", UserName: "hsimpson"}
+	first.Connect(homer)
+	first.Connect(homer)
+	eventually(t, func() bool { return len(second.Online()) == 1 })
+	assert.Equal(t, []model.OnlineUser{homer}, second.Online())
+	assert.True(t, <-changes)
+
+	// Still connected through the other socket
+	first.Disconnect("1")
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, second.Online(), 1)
+
+	first.Disconnect("1")
+	eventually(t, func() bool { return len(second.Online()) == 0 })
+	assert.False(t, <-changes)
+}
+
+func TestTrackerExpiresSilentServers(t *testing.T) {
+	tracker := NewTracker(broker.NewMemoryBroker())
+	tracker.receive(broker.Message{Topic: Topic, Data: []byte(`{"ServerId":"gone","Kind":"join","Users":[{"UserId":"1","UserName":"hsimpson"}]}`)})
+
+	assert.Len(t, tracker.Online(), 1)
+
+	tracker.expire(time.Now().Add(Expiry + time.Second))
+	assert.Len(t, tracker.Online(), 0)
+}
@@ -0,0 +1,55 @@
+package sanction
+
+import (
+	"time"
+
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is how often the worker looks for sanctions that have run out.
+const DefaultInterval = time.Minute
+
+// Worker lifts sanctions once they run out, so sanctioned users can be told they're over.
+type Worker struct {
+	DB       database.IDatabase
+	Lifted   func(s model.Sanction)
+	Interval time.Duration
+}
+
+// NewWorker creates a worker that calls lifted for every sanction it lifts.
+func NewWorker(d database.IDatabase, lifted func(s model.Sanction)) *Worker {
+	return &Worker{
+		DB:       d,
+		Lifted:   lifted,
+		Interval: DefaultInterval,
+	}
+}
+
+// Start lifts expired sanctions every interval, forever.
+func (w *Worker) Start() {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.LiftExpired()
+		<-ticker.C
+	}
+}
+
+// LiftExpired records every sanction that has run out as lifted.
+func (w *Worker) LiftExpired() {
+	sanctions, err := w.DB.ExpireSanctions()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Error lifting expired sanctions")
+		return
+	}
+
+	for _, s := range sanctions {
+		log.WithFields(log.Fields{"userID": s.UserId, "type": s.Type}).Info("Sanction expired")
+		if w.Lifted != nil {
+			w.Lifted(s)
+		}
+	}
+}
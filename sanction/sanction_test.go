@@ -0,0 +1,44 @@
+package sanction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDatabase struct {
+	database.IDatabase
+	expired []model.Sanction
+	err     error
+}
+
+func (f *fakeDatabase) ExpireSanctions() ([]model.Sanction, error) {
+	return f.expired, f.err
+}
+
+func TestLiftExpired(t *testing.T) {
+	d := &fakeDatabase{expired: []model.Sanction{{Id: "1", UserId: "a"}, {Id: "2", UserId: "b"}}}
+	var lifted []string
+	w := NewWorker(d, func(s model.Sanction) {
+		lifted = append(lifted, s.Id)
+	})
+
+	w.LiftExpired()
+
+	assert.Equal(t, []string{"1", "2"}, lifted)
+}
+
+func TestLiftExpiredError(t *testing.T) {
+	d := &fakeDatabase{err: errors.New("Database went away")}
+	called := false
+	w := NewWorker(d, func(s model.Sanction) {
+		called = true
+	})
+
+	w.LiftExpired()
+
+	assert.False(t, called)
+}
@@ -0,0 +1,161 @@
+/* Copyright 2017 Jeffry Hesse
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// eventStreamHeartbeat is how often a comment is sent down an idle event stream, so proxies don't
+	// close it
+	eventStreamHeartbeat = 30 * time.Second
+	// eventReplayLimit is the most missed events replayed to a client that reconnects
+	eventReplayLimit = 500
+)
+
+// eventStreamHandler streams the same events as the websocket over Server-Sent Events, for clients
+// behind proxies that break websockets. The topics to follow are given as a comma separated list in the
+// topics query parameter. EventSource can't set headers, so the token can also be sent as the token
+// query parameter. The stream ends when the token expires, and the client has to reconnect with a
+// fresh one.
+func eventStreamHandler(c *gin.Context, d database.IDatabase) {
+	token := c.GetHeader("Authorization")
+	if token == "" {
+		token = c.Query("token")
+	}
+
+	client := &client{
+		id:     uuid.NewV4().String(),
+		send:   make(chan []byte, 256),
+		topics: make(map[string]bool),
+	}
+	if err := client.identify(d, token); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"err": err.Error()})
+		return
+	}
+
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic == "" {
+			continue
+		}
+
+		if err := client.canSubscribe(d, topic); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "topic": topic})
+			return
+		}
+		topics = append(topics, topic)
+	}
+	if len(topics) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one topic is required"})
+		return
+	}
+
+	// Subscribe before replaying, so nothing published in between is missed. Anything already replayed
+	// is skipped when it arrives live.
+	manager.register <- client
+	tracker.Connect(model.OnlineUser{UserId: client.userID, UserName: client.userName})
+	defer func() {
+		manager.unregister <- client
+		tracker.Disconnect(client.userID)
+	}()
+	for _, topic := range topics {
+		manager.subscriptions <- subscription{client: client, topic: topic, action: "subscribe"}
+	}
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	lastSeq := lastEventID(c)
+	if lastSeq > 0 {
+		missed, err := d.GetEventsSince(lastSeq, topics, eventReplayLimit)
+		if err != nil {
+			log.Error(err)
+		}
+		for _, event := range missed {
+			bytes, err := json.Marshal(&event)
+			if err != nil {
+				continue
+			}
+			writeEvent(c, event.Seq, bytes)
+			lastSeq = event.Seq
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				c.Render(-1, sse.Event{Event: "close", Data: client.closeReason})
+				return false
+			}
+
+			var event model.Event
+			if err := json.Unmarshal(message, &event); err != nil || event.Id == "" {
+				// Replies to our own subscribe requests aren't events
+				return true
+			}
+			if event.Seq != 0 && event.Seq <= lastSeq {
+				return true
+			}
+			writeEvent(c, event.Seq, message)
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+		}
+		return true
+	})
+}
+
+// lastEventID reads the sequence number of the last event a reconnecting client saw. EventSource sends
+// it as the Last-Event-ID header, and polyfills can use the lastEventId query parameter instead.
+func lastEventID(c *gin.Context) int64 {
+	id := c.GetHeader("Last-Event-ID")
+	if id == "" {
+		id = c.Query("lastEventId")
+	}
+
+	seq, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+func writeEvent(c *gin.Context, seq int64, data []byte) {
+	event := sse.Event{Data: string(data)}
+	if seq != 0 {
+		event.Id = strconv.FormatInt(seq, 10)
+	}
+	c.Render(-1, event)
+}
@@ -0,0 +1,664 @@
+/* Copyright 2017 Jeffry Hesse
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DarthHater/bored-board-service/auth"
+	"github.com/DarthHater/bored-board-service/broker"
+	"github.com/DarthHater/bored-board-service/constants"
+	"github.com/DarthHater/bored-board-service/database"
+	"github.com/DarthHater/bored-board-service/events"
+	"github.com/DarthHater/bored-board-service/model"
+	"github.com/DarthHater/bored-board-service/policy"
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Close codes sent when the server ends a connection because of the client's credentials.
+const (
+	closeUnauthorized = 4001
+	closeTokenExpired = 4002
+	closeSignedOut    = 4003
+	closeRoleChanged  = 4004
+	closeSanctioned   = 4005
+)
+
+const (
+	// writeWait is how long a write to a socket can take
+	writeWait = 10 * time.Second
+	// pongWait is how long a client has to answer a ping before it's disconnected
+	pongWait = 60 * time.Second
+	// pingPeriod is how often clients are pinged, which has to be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// maxMessageSize is the largest message a client can send
+	maxMessageSize = 4096
+	// typingInterval is the most often a client can say it's typing in the same topic
+	typingInterval = 3 * time.Second
+	// maxSubscribeBackoff is the longest wait between attempts to subscribe to the broker
+	maxSubscribeBackoff = 30 * time.Second
+	// authTimeout is how long a client that didn't send a token in the handshake has to send an auth message
+	authTimeout = 10 * time.Second
+	// expiryInterval is how often the manager looks for clients whose token has expired
+	expiryInterval = 10 * time.Second
+)
+
+var (
+	errAuthRequired   = errors.New("token is required")
+	errWrongUser      = errors.New("token belongs to a different user")
+	errUnknownTopic   = errors.New("Unknown topic")
+	errTopicNotFound  = errors.New("Couldn't find that topic")
+	errUnknownAction  = errors.New("Unknown action")
+	errTopicForbidden = errors.New("User doesn't have access")
+	errNotTypeable    = errors.New("You can only type in threads and messages you've subscribed to")
+)
+
+// socketRequest is sent by a client to change which topics it's subscribed to, or to authenticate with a
+// new token before the current one expires.
+type socketRequest struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+	Token  string `json:"token"`
+}
+
+// socketReply lets a client know whether a request worked.
+type socketReply struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type topicMessage struct {
+	topic string
+	data  []byte
+}
+
+type subscription struct {
+	client *client
+	topic  string
+	action string
+	err    error
+}
+
+type authentication struct {
+	client    *client
+	expiresAt time.Time
+	err       error
+}
+
+type clientManager struct {
+	clients         map[*client]bool
+	topics          map[string]map[*client]bool
+	broadcast       chan topicMessage
+	subscriptions   chan subscription
+	authentications chan authentication
+	register        chan *client
+	unregister      chan *client
+	signOut         chan string
+}
+
+type client struct {
+	id       string
+	userID   string
+	userName string
+	role     constants.Role
+	muted    bool
+	socket   *websocket.Conn
+	send     chan []byte
+	// allowed and lastTyping are only touched by the read goroutine
+	allowed    map[string]bool
+	lastTyping map[string]time.Time
+	// topics, expiresAt and the close fields are only touched by the clientManager goroutine, until send
+	// is closed
+	topics      map[string]bool
+	expiresAt   time.Time
+	closeCode   int
+	closeReason string
+}
+
+var manager = clientManager{
+	broadcast:       make(chan topicMessage),
+	subscriptions:   make(chan subscription),
+	authentications: make(chan authentication),
+	register:        make(chan *client),
+	unregister:      make(chan *client),
+	signOut:         make(chan string),
+	clients:         make(map[*client]bool),
+	topics:          make(map[string]map[*client]bool),
+}
+
+func (manager *clientManager) start() {
+	expiry := time.NewTicker(expiryInterval)
+	defer expiry.Stop()
+
+	for {
+		select {
+		case conn := <-manager.register:
+			manager.clients[conn] = true
+			log.Debug("New connection registered")
+		case conn := <-manager.unregister:
+			manager.remove(conn)
+		case sub := <-manager.subscriptions:
+			manager.updateSubscription(sub)
+		case result := <-manager.authentications:
+			manager.authenticate(result)
+		case userID := <-manager.signOut:
+			for conn := range manager.clients {
+				if conn.userID == userID {
+					manager.disconnect(conn, closeSignedOut, "user has been signed out")
+				}
+			}
+		case now := <-expiry.C:
+			for conn := range manager.clients {
+				if now.After(conn.expiresAt) {
+					manager.disconnect(conn, closeTokenExpired, "token is expired")
+				}
+			}
+		case message := <-manager.broadcast:
+			for conn := range manager.topics[message.topic] {
+				select {
+				case conn.send <- message.data:
+				default:
+					manager.remove(conn)
+				}
+			}
+			if strings.HasPrefix(message.topic, events.UserTopicPrefix) {
+				manager.checkUserChange(message)
+			}
+		}
+	}
+}
+
+// disconnectUser closes every socket the user has open, such as when they log out everywhere or are
+// banned. Sockets on this server are closed straight away, and every other server closes its own when
+// the user.signed_out event reaches it.
+func disconnectUser(userID string) {
+	manager.signOut <- userID
+
+	err := publisher.PublishEphemeral(events.UserTopic(userID), events.UserSignedOut, events.SignOut{UserId: userID})
+	if err != nil {
+		log.WithFields(log.Fields{"userID": userID}).Error(err)
+	}
+}
+
+// checkUserChange disconnects a user's clients on this server when they're signed out from any server, or
+// when their role changes or they're muted, banned or let off, since what they're allowed to do was
+// checked when they connected. Clients that reconnect are checked again.
+func (manager *clientManager) checkUserChange(message topicMessage) {
+	var event struct {
+		Type    string
+		Payload struct {
+			UserId string
+		}
+	}
+	if err := json.Unmarshal(message.data, &event); err != nil {
+		return
+	}
+
+	code, reason := closeRoleChanged, "role has changed"
+	switch events.Type(event.Type) {
+	case events.UserRoleChanged:
+	case events.UserSignedOut:
+		code, reason = closeSignedOut, "user has been signed out"
+	case events.UserSanctioned, events.UserSanctionLifted:
+		code, reason = closeSanctioned, "sanctions have changed"
+	default:
+		return
+	}
+
+	for conn := range manager.clients {
+		if conn.userID == event.Payload.UserId {
+			manager.disconnect(conn, code, reason)
+		}
+	}
+}
+
+func (manager *clientManager) updateSubscription(sub subscription) {
+	conn := sub.client
+	if _, ok := manager.clients[conn]; !ok {
+		return
+	}
+
+	reply := socketReply{Type: sub.action + "d", Topic: sub.topic}
+	if sub.err != nil {
+		reply = socketReply{Type: "error", Topic: sub.topic, Error: sub.err.Error()}
+	} else if sub.action == "subscribe" {
+		if manager.topics[sub.topic] == nil {
+			manager.topics[sub.topic] = make(map[*client]bool)
+		}
+		manager.topics[sub.topic][conn] = true
+		conn.topics[sub.topic] = true
+	} else {
+		manager.unsubscribe(conn, sub.topic)
+	}
+
+	manager.reply(conn, reply)
+}
+
+// authenticate extends how long a client can stay connected when it sends a fresh token.
+func (manager *clientManager) authenticate(result authentication) {
+	conn := result.client
+	if _, ok := manager.clients[conn]; !ok {
+		return
+	}
+
+	if result.err != nil {
+		manager.reply(conn, socketReply{Type: "error", Error: result.err.Error()})
+		return
+	}
+
+	conn.expiresAt = result.expiresAt
+	manager.reply(conn, socketReply{Type: "authenticated"})
+}
+
+func (manager *clientManager) reply(conn *client, reply socketReply) {
+	bytes, err := json.Marshal(&reply)
+	if err != nil {
+		return
+	}
+
+	select {
+	case conn.send <- bytes:
+	default:
+		manager.remove(conn)
+	}
+}
+
+func (manager *clientManager) unsubscribe(conn *client, topic string) {
+	delete(conn.topics, topic)
+	delete(manager.topics[topic], conn)
+	if len(manager.topics[topic]) == 0 {
+		delete(manager.topics, topic)
+	}
+}
+
+// disconnect closes a client's socket with a close code and reason explaining why.
+func (manager *clientManager) disconnect(conn *client, code int, reason string) {
+	conn.closeCode = code
+	conn.closeReason = reason
+	manager.remove(conn)
+}
+
+func (manager *clientManager) remove(conn *client) {
+	if _, ok := manager.clients[conn]; !ok {
+		return
+	}
+
+	for topic := range conn.topics {
+		manager.unsubscribe(conn, topic)
+	}
+	close(conn.send)
+	delete(manager.clients, conn)
+}
+
+// subscribe is the only subscriber to the broker, and feeds every event published by any server to the
+// manager. It subscribes again whenever the subscription fails, such as when Redis goes away.
+func (manager *clientManager) subscribe() {
+	patterns := []string{
+		events.ThreadsIndexTopic,
+		events.ThreadTopic("*"),
+		events.MessageTopic("*"),
+		events.UserTopic("*"),
+	}
+	backoff := time.Second
+
+	for {
+		started := time.Now()
+		err := messageBroker.Subscribe(patterns, func(m broker.Message) {
+			manager.broadcast <- topicMessage{topic: m.Topic, data: m.Data}
+		})
+		if err == broker.ErrClosed {
+			return
+		}
+		log.WithFields(log.Fields{"error": err}).Warn("Lost the broker subscription, resubscribing")
+
+		// Only back off further when subscribing keeps failing straight away
+		if time.Since(started) > maxSubscribeBackoff {
+			backoff = time.Second
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxSubscribeBackoff {
+			backoff = maxSubscribeBackoff
+		}
+	}
+}
+
+// authenticate checks the token a client sent, either in the handshake or as its first message, and ties
+// the client to the user the token belongs to.
+func (c *client) authenticate(d database.IDatabase, tokenString string) error {
+	if tokenString == "" {
+		c.socket.SetReadDeadline(time.Now().Add(authTimeout))
+
+		var request socketRequest
+		if err := c.socket.ReadJSON(&request); err != nil || request.Action != "auth" {
+			return errAuthRequired
+		}
+		tokenString = request.Token
+
+		c.socket.SetReadDeadline(time.Time{})
+	}
+
+	return c.identify(d, tokenString)
+}
+
+// identify ties the client to the user a token belongs to, as long as they're still allowed to read
+// the board.
+func (c *client) identify(d database.IDatabase, tokenString string) error {
+	user, err := a.ParseToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	u, err := d.GetUserByID(user.ID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Error(err)
+		return errTopicForbidden
+	}
+
+	role := constants.Role(u.UserRole)
+	if err = policy.CanRead(role); err != nil {
+		return err
+	}
+
+	sanctions, err := d.GetActiveSanctions(user.ID)
+	if err != nil {
+		log.WithFields(log.Fields{"userID": user.ID}).Error(err)
+		return errTopicForbidden
+	}
+	if _, banned := auth.FindSanction(sanctions, constants.SanctionBan); banned {
+		return policy.ErrBanned
+	}
+	_, c.muted = auth.FindSanction(sanctions, constants.SanctionMute)
+
+	c.userID = user.ID
+	c.userName = u.Username
+	c.role = role
+	c.expiresAt = user.ExpiresAt
+	return nil
+}
+
+// reauthenticate checks a fresh token sent by an already connected client.
+func (c *client) reauthenticate(tokenString string) authentication {
+	user, err := a.ParseToken(tokenString)
+	if err != nil {
+		return authentication{client: c, err: err}
+	}
+	if user.ID != c.userID {
+		return authentication{client: c, err: errWrongUser}
+	}
+
+	return authentication{client: c, expiresAt: user.ExpiresAt}
+}
+
+// read handles subscribe, unsubscribe and auth requests sent by the client, and keeps the connection
+// alive as long as the client answers pings.
+func (c *client) read() {
+	defer func() {
+		manager.unregister <- c
+		tracker.Disconnect(c.userID)
+		c.socket.Close()
+	}()
+
+	c.socket.SetReadLimit(maxMessageSize)
+	c.socket.SetReadDeadline(time.Now().Add(pongWait))
+	c.socket.SetPongHandler(func(string) error {
+		return c.socket.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var request socketRequest
+		if err := c.socket.ReadJSON(&request); err != nil {
+			if _, ok := err.(*json.UnmarshalTypeError); ok {
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.WithFields(log.Fields{"userID": c.userID}).Debug(err)
+			}
+			return
+		}
+
+		if request.Action == "auth" {
+			manager.authentications <- c.reauthenticate(request.Token)
+			continue
+		}
+
+		if request.Action == "typing" {
+			if err := c.typing(request.Topic); err != nil {
+				manager.subscriptions <- subscription{client: c, topic: request.Topic, action: request.Action, err: err}
+			}
+			continue
+		}
+
+		sub := subscription{client: c, topic: request.Topic, action: request.Action}
+		switch request.Action {
+		case "subscribe":
+			sub.err = c.canSubscribe(db, request.Topic)
+			if sub.err == nil {
+				c.allowed[request.Topic] = true
+			}
+		case "unsubscribe":
+			delete(c.allowed, request.Topic)
+			delete(c.lastTyping, request.Topic)
+		default:
+			sub.err = errUnknownAction
+		}
+
+		manager.subscriptions <- sub
+	}
+}
+
+// typing lets everyone else following a thread or message know the user is typing. It's never stored,
+// and is dropped if the client already said so recently.
+func (c *client) typing(topic string) error {
+	typeable := strings.HasPrefix(topic, events.ThreadTopicPrefix) || strings.HasPrefix(topic, events.MessageTopicPrefix)
+	if !typeable || !c.allowed[topic] {
+		return errNotTypeable
+	}
+	if err := policy.CanWrite(c.role); err != nil {
+		return err
+	}
+	if c.muted {
+		return policy.ErrMuted
+	}
+
+	if time.Since(c.lastTyping[topic]) < typingInterval {
+		return nil
+	}
+	c.lastTyping[topic] = time.Now()
+
+	return publisher.PublishEphemeral(topic, events.UserTyping, events.Typing{
+		UserId:   c.userID,
+		UserName: c.userName,
+		Topic:    topic,
+	})
+}
+
+// broadcastPresence tells this server's clients following presence that a user came online or went
+// offline. Every server's tracker sees the same changes, so this isn't published through the broker.
+func broadcastPresence(user model.OnlineUser, online bool) {
+	eventType := events.PresenceLeft
+	if online {
+		eventType = events.PresenceJoined
+	}
+
+	bytes, err := json.Marshal(events.New(events.PresenceTopic, eventType, user))
+	if err != nil {
+		return
+	}
+
+	manager.broadcast <- topicMessage{topic: events.PresenceTopic, data: bytes}
+}
+
+// canSubscribe checks the client is allowed to receive events for a topic. Private messages are only
+// sent to their members, and user topics only to that user.
+func (c *client) canSubscribe(d database.IDatabase, topic string) error {
+	switch {
+	case topic == events.ThreadsIndexTopic, topic == events.PresenceTopic:
+		return nil
+	case strings.HasPrefix(topic, events.ThreadTopicPrefix):
+		thread, err := d.GetThread(strings.TrimPrefix(topic, events.ThreadTopicPrefix))
+		if err == database.ErrNoThread {
+			return errTopicNotFound
+		}
+		if err != nil {
+			log.Error(err)
+			return errTopicForbidden
+		}
+
+		category, err := d.GetCategory(thread.CategoryId)
+		if err != nil {
+			log.Error(err)
+			return errTopicForbidden
+		}
+		if !c.role.HasAccess(constants.Role(category.RequiredRole)) {
+			return errTopicForbidden
+		}
+		return nil
+	case strings.HasPrefix(topic, events.MessageTopicPrefix):
+		member, err := d.IsMessageMember(strings.TrimPrefix(topic, events.MessageTopicPrefix), c.userID)
+		if err != nil {
+			log.Error(err)
+			return errTopicForbidden
+		}
+		if !member {
+			return errTopicForbidden
+		}
+		return nil
+	case strings.HasPrefix(topic, events.UserTopicPrefix):
+		if strings.TrimPrefix(topic, events.UserTopicPrefix) != c.userID {
+			return errTopicForbidden
+		}
+		return nil
+	default:
+		return errUnknownTopic
+	}
+}
+
+// write sends queued events to the client and pings it, giving up on clients that stop reading.
+func (c *client) write() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.socket.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.socket.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.socket.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeReason))
+				return
+			}
+			if err := c.socket.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.socket.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.socket.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var webSocketUpgrade = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Browsers can't set an Authorization header on a websocket, so the token can be sent as the
+	// subprotocols "bearer, <token>" instead
+	Subprotocols: []string{"bearer"},
+	CheckOrigin:  allowedWebSocketOrigin,
+}
+
+// allowedWebSocketOrigin only lets browsers on the origins allowed by CORS open a socket. Requests
+// without an Origin header don't come from a browser, and still need a token.
+func allowedWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range allowedCorsOrigins() {
+		if origin == allowed {
+			return true
+		}
+	}
+
+	log.WithFields(log.Fields{"origin": origin}).Warn("Websocket connection from an origin that isn't allowed")
+	return false
+}
+
+// webSocketToken finds the token sent with the handshake, either as the token query parameter or after
+// the bearer subprotocol. An empty token means the client will send an auth message instead.
+func webSocketToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == "bearer" && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
+}
+
+// Websocket Handler
+func webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	token := webSocketToken(r)
+
+	conn, err := webSocketUpgrade.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	client := &client{
+		id:         uuid.NewV4().String(),
+		socket:     conn,
+		send:       make(chan []byte, 16),
+		topics:     make(map[string]bool),
+		allowed:    make(map[string]bool),
+		lastTyping: make(map[string]time.Time),
+	}
+
+	go func() {
+		if err := client.authenticate(db, token); err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeUnauthorized, err.Error()),
+				time.Now().Add(writeWait))
+			conn.Close()
+			return
+		}
+
+		manager.register <- client
+		tracker.Connect(model.OnlineUser{UserId: client.userID, UserName: client.userName})
+
+		go client.write()
+		client.read()
+	}()
+}